@@ -101,8 +101,38 @@ extern "C" {
 extern int startMultiDownload(char** urls, int urlCount, char** savePaths, int pathCount, int threadCount, int chunkSizeMB, void* callback, _Bool useCallbackURL, char* remoteCallbackUrl, _Bool* useSocket);
 extern int startDownload(int threadCount, int chunkSizeMB, char* urlStr, char* savePath, void* callback, _Bool useCallbackURL, char* remoteCallbackUrl, _Bool* useSocket);
 extern int getDownloader(char** urls, int urlCount, char** savePaths, int pathCount, int threadCount, int chunkSizeMB);
+extern int loadMetalink(char* metalinkPath, char* saveDir, int threadCount, int chunkSizeMB);
+extern int startDownloadByID(int id);
+extern int setRetryPolicy(int id, int maxRetries, int baseDelayMs, int maxDelayMs);
+extern int setThrottleAllChunks(int id, _Bool throttleAll);
+extern int setConcurrency(int id, int maxFiles, int maxConnections);
+extern int setMirrors(int id, int index, char** mirrors, int mirrorCount);
+extern int setChecksum(int id, int index, char* checksum);
+extern int setDeleteOnChecksumMismatch(int id, _Bool deleteFile);
+extern int setAutoVerify(int id, char* sidecarExtension, _Bool useServerDigests);
+extern int setManifest(int id, int index, char* manifestPath);
+extern int setRepairMode(int id, _Bool repair);
+extern int setManifestOutput(int id, long long int chunkSize, char* algorithm);
+extern int setTLSConfig(int id, char* options);
+extern int setClientCertificate(int id, char* certificate, char* key, char* password);
+extern int setProxy(int id, char* proxyURL, char* noProxy);
+extern int setGlobalLimits(int maxConnections, int maxPerHost);
+extern int removeDownloader(int id);
+extern int setRateLimit(int id, long long int bytesPerSecond);
+extern int setGlobalRateLimit(long long int bytesPerSecond);
+extern int setHostRateLimit(char* host, long long int bytesPerSecond);
+extern int setBandwidthSchedule(int id, char* schedule);
+extern int enqueueDownload(int id, int priority);
+extern int setDownloadPriority(int id, int priority);
+extern int promoteDownload(int id);
+extern int dequeueDownload(int id);
+extern int setMaxActiveDownloads(int maxActive);
+extern char* listQueue(void);
+extern void freeString(char* str);
 extern int pauseDownload(int id);
 extern int resumeDownload(int id);
+extern int getDownloadState(int id);
+extern int cancelDownload(int id);
 
 #ifdef __cplusplus
 }
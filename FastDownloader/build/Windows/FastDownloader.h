@@ -101,8 +101,38 @@ extern "C" {
 extern __declspec(dllexport) int startMultiDownload(char** urls, int urlCount, char** savePaths, int pathCount, int threadCount, int chunkSizeMB, void* callback, _Bool useCallbackURL, char* remoteCallbackUrl, _Bool* useSocket);
 extern __declspec(dllexport) int startDownload(int threadCount, int chunkSizeMB, char* urlStr, char* savePath, void* callback, _Bool useCallbackURL, char* remoteCallbackUrl, _Bool* useSocket);
 extern __declspec(dllexport) int getDownloader(char** urls, int urlCount, char** savePaths, int pathCount, int threadCount, int chunkSizeMB);
+extern __declspec(dllexport) int loadMetalink(char* metalinkPath, char* saveDir, int threadCount, int chunkSizeMB);
+extern __declspec(dllexport) int startDownloadByID(int id);
+extern __declspec(dllexport) int setRetryPolicy(int id, int maxRetries, int baseDelayMs, int maxDelayMs);
+extern __declspec(dllexport) int setThrottleAllChunks(int id, _Bool throttleAll);
+extern __declspec(dllexport) int setConcurrency(int id, int maxFiles, int maxConnections);
+extern __declspec(dllexport) int setMirrors(int id, int index, char** mirrors, int mirrorCount);
+extern __declspec(dllexport) int setChecksum(int id, int index, char* checksum);
+extern __declspec(dllexport) int setDeleteOnChecksumMismatch(int id, _Bool deleteFile);
+extern __declspec(dllexport) int setAutoVerify(int id, char* sidecarExtension, _Bool useServerDigests);
+extern __declspec(dllexport) int setManifest(int id, int index, char* manifestPath);
+extern __declspec(dllexport) int setRepairMode(int id, _Bool repair);
+extern __declspec(dllexport) int setManifestOutput(int id, long long int chunkSize, char* algorithm);
+extern __declspec(dllexport) int setTLSConfig(int id, char* options);
+extern __declspec(dllexport) int setClientCertificate(int id, char* certificate, char* key, char* password);
+extern __declspec(dllexport) int setProxy(int id, char* proxyURL, char* noProxy);
+extern __declspec(dllexport) int setGlobalLimits(int maxConnections, int maxPerHost);
+extern __declspec(dllexport) int removeDownloader(int id);
+extern __declspec(dllexport) int setRateLimit(int id, long long int bytesPerSecond);
+extern __declspec(dllexport) int setGlobalRateLimit(long long int bytesPerSecond);
+extern __declspec(dllexport) int setHostRateLimit(char* host, long long int bytesPerSecond);
+extern __declspec(dllexport) int setBandwidthSchedule(int id, char* schedule);
+extern __declspec(dllexport) int enqueueDownload(int id, int priority);
+extern __declspec(dllexport) int setDownloadPriority(int id, int priority);
+extern __declspec(dllexport) int promoteDownload(int id);
+extern __declspec(dllexport) int dequeueDownload(int id);
+extern __declspec(dllexport) int setMaxActiveDownloads(int maxActive);
+extern __declspec(dllexport) char* listQueue(void);
+extern __declspec(dllexport) void freeString(char* str);
 extern __declspec(dllexport) int pauseDownload(int id);
 extern __declspec(dllexport) int resumeDownload(int id);
+extern __declspec(dllexport) int getDownloadState(int id);
+extern __declspec(dllexport) int cancelDownload(int id);
 
 #ifdef __cplusplus
 }
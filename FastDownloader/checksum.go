@@ -0,0 +1,166 @@
+package main
+
+import (
+    "crypto/md5"
+    "crypto/sha1"
+    "crypto/sha256"
+    "crypto/sha512"
+    "encoding/hex"
+    "errors"
+    "fmt"
+    "hash"
+    "hash/crc32"
+    "io"
+    "os"
+    "strings"
+)
+
+// ErrChecksumMismatch 下载完成的文件与期望的校验和不一致
+var ErrChecksumMismatch = errors.New("校验和不匹配")
+
+// newChecksumHash 根据算法名创建哈希，支持 md5、sha1、sha256、sha512、crc32（IEEE）和 crc32c（Castagnoli）
+func newChecksumHash(algorithm string) (hash.Hash, error) {
+    switch algorithm {
+    case "md5":
+        return md5.New(), nil
+    case "sha1":
+        return sha1.New(), nil
+    case "sha256":
+        return sha256.New(), nil
+    case "sha512":
+        return sha512.New(), nil
+    case "crc32":
+        return crc32.NewIEEE(), nil
+    case "crc32c":
+        return crc32.New(crc32.MakeTable(crc32.Castagnoli)), nil
+    default:
+        return nil, fmt.Errorf("不支持的校验算法: %s", algorithm)
+    }
+}
+
+// parseChecksum 解析 "算法:十六进制值" 格式的校验和，例如 "sha256:9f86d0..."，空字符串表示不校验
+func parseChecksum(spec string) (algorithm string, value string, err error) {
+    if spec == "" {
+        return "", "", nil
+    }
+    algorithm, value, ok := strings.Cut(spec, ":")
+    if !ok {
+        return "", "", fmt.Errorf("校验和格式应为 算法:值: %q", spec)
+    }
+    algorithm = strings.ToLower(strings.TrimSpace(algorithm))
+    value = strings.ToLower(strings.TrimSpace(value))
+
+    h, err := newChecksumHash(algorithm)
+    if err != nil {
+        return "", "", err
+    }
+    if decoded, err := hex.DecodeString(value); err != nil || len(decoded) != h.Size() {
+        return "", "", fmt.Errorf("无效的 %s 校验和: %q", algorithm, value)
+    }
+    return algorithm, value, nil
+}
+
+// ValidateChecksums 检查校验和的格式，数量不能多于 URL 数量
+func ValidateChecksums(checksums []string, urlCount int) error {
+    if len(checksums) > urlCount {
+        return fmt.Errorf("校验和数量多于URL数量")
+    }
+    for i, spec := range checksums {
+        if _, _, err := parseChecksum(spec); err != nil {
+            return fmt.Errorf("第 %d 个文件的校验和: %v", i+1, err)
+        }
+    }
+    return nil
+}
+
+// fileChecksum 计算文件的哈希值
+func fileChecksum(path string, algorithm string) (string, error) {
+    h, err := newChecksumHash(algorithm)
+    if err != nil {
+        return "", err
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        return "", err
+    }
+    defer file.Close()
+
+    if _, err := io.Copy(h, file); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// expectedChecksum 获取用于校验的校验和及其来源：优先使用配置的校验和（config），
+// 其次是块哈希清单（manifest）、校验文件（sidecar），最后是服务器响应头中的摘要（server），都没有时返回空字符串
+func (ft *fileTask) expectedChecksum() (string, string) {
+    if ft.index < len(ft.fd.config.Checksums) && ft.fd.config.Checksums[ft.index] != "" {
+        return ft.fd.config.Checksums[ft.index], "config"
+    }
+    if manifest := ft.manifest(); manifest != nil && manifest.Checksum != "" {
+        return manifest.Checksum, "manifest"
+    }
+
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    if ft.sidecarChecksum != "" {
+        return ft.sidecarChecksum, "sidecar"
+    }
+    if ft.remote != nil && !ft.fd.config.IgnoreServerDigests {
+        if spec := preferredDigest(ft.remote.Digests); spec != "" {
+            return spec, "server"
+        }
+    }
+    return "", ""
+}
+
+// verifyChecksum 下载完成后按期望的校验和校验文件并发送 verify 事件。
+// 各块并发写入不同位置，无法按顺序边下载边计算，因此在文件完成后重新读取一遍
+func (ft *fileTask) verifyChecksum() error {
+    spec, source := ft.expectedChecksum()
+    algorithm, expected, err := parseChecksum(spec)
+    if err != nil || algorithm == "" {
+        return err
+    }
+
+    actual, err := fileChecksum(ft.savePath, algorithm)
+    if err != nil {
+        ft.send(Event{
+            Type: EventTypeMsg,
+            Name: "错误",
+        }, map[string]interface{}{
+            "Text": fmt.Sprintf("计算校验和失败: %v", err),
+        })
+        return fmt.Errorf("计算校验和失败: %v", err)
+    }
+
+    match := actual == expected
+    ft.send(Event{
+        Type: EventTypeVerify,
+        Name: "校验",
+    }, map[string]interface{}{
+        "URL":       ft.url,
+        "Algorithm": algorithm,
+        "Expected":  expected,
+        "Actual":    actual,
+        "Match":     match,
+        "Source":    source,
+    })
+    if match {
+        return nil
+    }
+
+    if ft.fd.config.DeleteOnChecksumMismatch {
+        if err := os.Remove(ft.savePath); err != nil && !os.IsNotExist(err) {
+            ft.send(Event{
+                Type: EventTypeMsg,
+                Name: "警告",
+            }, map[string]interface{}{
+                "Text": fmt.Sprintf("警告: 删除校验失败的文件失败: %v", err),
+            })
+        }
+    }
+    return fmt.Errorf("%w: %s 期望 %s，实际 %s", ErrChecksumMismatch, algorithm, expected, actual)
+}
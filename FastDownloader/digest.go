@@ -0,0 +1,224 @@
+package main
+
+import (
+    "bufio"
+    "context"
+    "encoding/base64"
+    "encoding/hex"
+    "fmt"
+    "io"
+    "net/http"
+    "net/url"
+    "path"
+    "strings"
+)
+
+// maxSidecarSize 校验文件的最大读取长度
+const maxSidecarSize = 1024 * 1024
+
+// digestPreference 服务器提供多个摘要时按此顺序选择用于校验的算法
+var digestPreference = []string{"sha512", "sha256", "sha1", "md5", "crc32c"}
+
+// digestAlgorithm 将响应头中的摘要算法名转换为校验和算法名，不支持的算法返回空字符串
+func digestAlgorithm(name string) string {
+    switch strings.ToLower(strings.TrimSpace(name)) {
+    case "md5":
+        return "md5"
+    case "sha", "sha-1":
+        return "sha1"
+    case "sha-256":
+        return "sha256"
+    case "sha-512":
+        return "sha512"
+    case "crc32c":
+        return "crc32c"
+    default:
+        return ""
+    }
+}
+
+// decodeDigest 将 base64 编码（部分服务器使用十六进制）的摘要转换为十六进制，长度与算法不符时返回空字符串
+func decodeDigest(algorithm string, value string) string {
+    h, err := newChecksumHash(algorithm)
+    if err != nil {
+        return ""
+    }
+    value = strings.TrimSpace(value)
+    if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && len(decoded) == h.Size() {
+        return hex.EncodeToString(decoded)
+    }
+    if decoded, err := hex.DecodeString(value); err == nil && len(decoded) == h.Size() {
+        return hex.EncodeToString(decoded)
+    }
+    return ""
+}
+
+// parseDigests 从响应头的 Repr-Digest、Digest、Content-MD5 和 x-goog-hash 中收集完整文件的摘要（算法 -> 十六进制值）。
+// partial 表示响应体只是文件的一部分，此时 Content-MD5 不代表完整文件；
+// 响应使用了内容编码时摘要针对的是编码后的数据，不予使用
+func parseDigests(header http.Header, partial bool) map[string]string {
+    if encoding := strings.TrimSpace(header.Get("Content-Encoding")); encoding != "" && !strings.EqualFold(encoding, "identity") {
+        return nil
+    }
+
+    digests := make(map[string]string)
+    add := func(name string, value string) {
+        algorithm := digestAlgorithm(name)
+        if algorithm == "" {
+            return
+        }
+        if digest := decodeDigest(algorithm, value); digest != "" {
+            if _, exists := digests[algorithm]; !exists {
+                digests[algorithm] = digest
+            }
+        }
+    }
+
+    // Repr-Digest: sha-256=:<base64>:
+    for _, field := range header.Values("Repr-Digest") {
+        for _, item := range strings.Split(field, ",") {
+            if name, value, ok := strings.Cut(item, "="); ok {
+                add(name, strings.Trim(strings.TrimSpace(value), ":"))
+            }
+        }
+    }
+    // Digest: SHA-256=<base64>
+    for _, field := range header.Values("Digest") {
+        for _, item := range strings.Split(field, ",") {
+            if name, value, ok := strings.Cut(item, "="); ok {
+                add(name, value)
+            }
+        }
+    }
+    if value := header.Get("Content-MD5"); value != "" && !partial {
+        add("md5", value)
+    }
+    // x-goog-hash: crc32c=<base64>, md5=<base64>
+    for _, field := range header.Values("X-Goog-Hash") {
+        for _, item := range strings.Split(field, ",") {
+            if name, value, ok := strings.Cut(item, "="); ok {
+                add(name, value)
+            }
+        }
+    }
+
+    if len(digests) == 0 {
+        return nil
+    }
+    return digests
+}
+
+// preferredDigest 选择最强的服务器摘要，返回 "算法:十六进制值"，没有时返回空字符串
+func preferredDigest(digests map[string]string) string {
+    for _, algorithm := range digestPreference {
+        if value, ok := digests[algorithm]; ok {
+            return algorithm + ":" + value
+        }
+    }
+    return ""
+}
+
+// validateChecksumSidecar 检查校验文件扩展名，扩展名即校验算法
+func validateChecksumSidecar(extension string) error {
+    switch extension {
+    case "", "md5", "sha1", "sha256", "sha512":
+        return nil
+    default:
+        return fmt.Errorf("不支持的校验文件扩展名: %s", extension)
+    }
+}
+
+// sidecarURL 校验文件的地址：在 URL 路径后追加扩展名，保留查询参数
+func sidecarURL(rawURL string, extension string) (string, error) {
+    parsed, err := url.Parse(rawURL)
+    if err != nil {
+        return "", err
+    }
+    parsed.Path += "." + extension
+    parsed.RawPath = ""
+    return parsed.String(), nil
+}
+
+// parseSidecar 解析校验文件，支持只有哈希值、"哈希值  文件名"（sha256sum 格式）以及
+// "SHA256 (文件名) = 哈希值"（BSD 格式）。包含多个文件时按文件名查找
+func parseSidecar(content string, algorithm string, fileName string) (string, error) {
+    var candidates []string
+    var matched string
+    scanner := bufio.NewScanner(strings.NewReader(content))
+    for scanner.Scan() {
+        line := strings.TrimSpace(scanner.Text())
+        if line == "" || strings.HasPrefix(line, "#") {
+            continue
+        }
+
+        var value, name string
+        start := strings.Index(line, " (")
+        end := strings.LastIndex(line, ") = ")
+        if start > 0 && end > start {
+            name = line[start+2 : end]
+            value = line[end+4:]
+        } else {
+            fields := strings.Fields(line)
+            value = fields[0]
+            if len(fields) > 1 {
+                name = strings.TrimPrefix(fields[1], "*")
+            }
+        }
+
+        value = decodeDigest(algorithm, value)
+        if value == "" {
+            continue
+        }
+        candidates = append(candidates, value)
+        if name != "" && path.Base(name) == fileName && matched == "" {
+            matched = value
+        }
+    }
+
+    switch {
+    case matched != "":
+        return matched, nil
+    case len(candidates) == 1:
+        return candidates[0], nil
+    case len(candidates) == 0:
+        return "", fmt.Errorf("校验文件中没有有效的 %s 值", algorithm)
+    default:
+        return "", fmt.Errorf("校验文件中没有 %s 的校验和", fileName)
+    }
+}
+
+// fetchSidecarChecksum 下载 URL 旁边的校验文件，返回 "算法:十六进制值"
+func (fd *FastDownloader) fetchSidecarChecksum(ctx context.Context, rawURL string, extension string) (string, error) {
+    checksumURL, err := sidecarURL(rawURL, extension)
+    if err != nil {
+        return "", err
+    }
+
+    req, err := http.NewRequestWithContext(ctx, "GET", checksumURL, nil)
+    if err != nil {
+        return "", err
+    }
+    resp, err := fd.client.Do(req)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return "", fmt.Errorf("HTTP错误: %d", resp.StatusCode)
+    }
+    content, err := io.ReadAll(io.LimitReader(resp.Body, maxSidecarSize))
+    if err != nil {
+        return "", err
+    }
+
+    fileName := ""
+    if parsed, err := url.Parse(rawURL); err == nil {
+        fileName = path.Base(parsed.Path)
+    }
+    value, err := parseSidecar(string(content), extension, fileName)
+    if err != nil {
+        return "", err
+    }
+    return extension + ":" + value, nil
+}
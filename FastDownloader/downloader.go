@@ -2,12 +2,14 @@ package main
 
 import (
     "context"
-    "crypto/tls"
+    "encoding/json"
+    "errors"
     "fmt"
     "io"
     "net/http"
     "os"
     "strconv"
+    "strings"
     "sync"
     "sync/atomic"
     "time"
@@ -26,12 +28,33 @@ type DownloadConfig struct {
     useCallbackURL bool
     CallbackURL    *string
     useSocket      *bool
+    MaxRetries     int           // 每个块的最大重试次数，0 使用默认值，负数表示不重试
+    RetryBaseDelay time.Duration // 首次重试的等待时间，之后按指数增长，0 使用默认值
+    RetryMaxDelay  time.Duration // 重试等待时间上限，0 使用默认值
+    ThrottleAllChunks bool       // 被限流（429/503）时暂停该主机的所有块，而不仅是被限流的块
+    Mirrors        [][]string    // 对应每个URL的镜像地址，各镜像必须提供相同的文件
+    MaxConcurrentFiles int       // 同时下载的文件数，0 或 1 表示按顺序逐个下载
+    MaxConnections int           // 所有文件共享的最大下载连接数，0 表示不限制
+    MaxBytesPerSecond int64      // 本下载器的限速（字节/秒），0 表示不限速，运行中通过 SetRateLimit 调整
+    Schedule       []BandwidthRule // 带宽计划，不在任何时间段内时使用 MaxBytesPerSecond，运行中通过 SetSchedule 调整
+    Checksums      []string      // 对应每个URL的期望校验和（"算法:十六进制值"），空字符串表示不校验
+    DeleteOnChecksumMismatch bool // 校验和不匹配时删除下载的文件
+    ChecksumSidecar string       // 校验文件扩展名（md5、sha1、sha256 或 sha512），设置后从 "<URL>.<扩展名>" 获取校验和
+    IgnoreServerDigests bool     // 不使用服务器响应头中的摘要自动校验
+    Manifests      []*ChunkManifest // 对应每个URL的块哈希清单，nil 表示没有
+    Repair         bool          // 修复模式：按块哈希清单校验已有文件，只重新下载不一致的块
+    ManifestChunkSize int64      // 下载完成后按此块大小（字节）生成块哈希清单，0 表示不生成
+    ManifestAlgorithm string     // 生成块哈希清单使用的算法，空字符串使用 sha256
+    ExpectedSizes  []int64       // 对应每个URL的期望文件大小，0 表示不检查
+    TLS            TLSOptions    // HTTPS 证书校验设置，默认校验服务器证书
+    Proxy          ProxyOptions  // 代理设置，默认按环境变量使用代理
 }
 
 // DownloadChunk 下载块信息
 type DownloadChunk struct {
     StartOffset int64
     EndOffset   int64
+    Downloaded  int64 // 已写入文件的字节数，当前写入位置为 StartOffset + Downloaded
     Done        bool
 }
 
@@ -46,14 +69,97 @@ const (
     EventTypeEnd       EventType = "end"
     EventTypeEndOne    EventType = "endOne"
     EventTypeMsg       EventType = "msg"
+    EventTypeSplit     EventType = "split"
+    EventTypeRestart   EventType = "restart"
+    EventTypePaused    EventType = "paused"
+    EventTypeResumed   EventType = "resumed"
+    EventTypeCancelled EventType = "cancelled"
+    EventTypeRunning   EventType = "running"
+    EventTypeCompleted EventType = "completed"
+    EventTypeFailed    EventType = "failed"
+    EventTypeRetry     EventType = "retry"
+    EventTypeThrottled EventType = "throttled"
+    EventTypeMirrorDropped EventType = "mirrorDropped"
+    EventTypeSchedule  EventType = "schedule"
+    EventTypeVerify    EventType = "verify"
+    EventTypeRepair    EventType = "repair"
+    EventTypeManifest  EventType = "manifest"
 )
 
+// maxRestarts 远程文件变化时重新下载的最大次数
+const maxRestarts = 3
+
+// errResourceChanged 下载过程中远程文件发生变化
+var errResourceChanged = errors.New("远程文件已变化")
+
+// errRangeNotSupported 服务器忽略了 Range 请求头，返回了完整文件
+var errRangeNotSupported = errors.New("服务器不支持分块下载")
+
+// errInvalidContentRange 206 响应的 Content-Range 与请求的范围不一致
+var errInvalidContentRange = errors.New("Content-Range 与请求的范围不一致")
+
+// ErrPaused 下载被暂停，已下载的数据保留在控制文件中
+var ErrPaused = errors.New("下载已暂停")
+
+// ErrCancelled 下载被取消，未完成的文件和控制文件已删除
+var ErrCancelled = errors.New("下载已取消")
+
 // Event 下载事件
 type Event struct {
     Type EventType
     Name string
 }
 
+// RemoteFileInfo 远程文件信息
+type RemoteFileInfo struct {
+    Size         int64
+    ETag         string
+    LastModified string
+    AcceptRanges bool // 服务器是否支持 Range 请求
+    Digests      map[string]string // 服务器响应头中的完整文件摘要（算法 -> 十六进制值）
+}
+
+// ifRange 获取用于 If-Range 请求头的校验值，弱 ETag 不能用于 If-Range
+func (info *RemoteFileInfo) ifRange() string {
+    if info.ETag != "" && !strings.HasPrefix(info.ETag, "W/") {
+        return info.ETag
+    }
+    return info.LastModified
+}
+
+// changedFrom 根据响应头中的 ETag、Last-Modified 判断远程文件是否已变化
+func (info *RemoteFileInfo) changedFrom(header http.Header) bool {
+    if etag := header.Get("ETag"); info.ETag != "" && etag != "" {
+        return etag != info.ETag
+    }
+    if lastModified := header.Get("Last-Modified"); info.LastModified != "" && lastModified != "" {
+        return lastModified != info.LastModified
+    }
+    return false
+}
+
+// parseContentRange 解析 "bytes start-end/total" 格式的 Content-Range，总大小未知时 total 为 -1
+func parseContentRange(value string) (int64, int64, int64, error) {
+    var start, end int64
+    var totalStr string
+    if _, err := fmt.Sscanf(value, "bytes %d-%d/%s", &start, &end, &totalStr); err != nil {
+        return 0, 0, 0, fmt.Errorf("无法解析 Content-Range: %q", value)
+    }
+    if start < 0 || end < start {
+        return 0, 0, 0, fmt.Errorf("无法解析 Content-Range: %q", value)
+    }
+
+    total := int64(-1)
+    if totalStr != "*" {
+        parsed, err := strconv.ParseInt(totalStr, 10, 64)
+        if err != nil {
+            return 0, 0, 0, fmt.Errorf("无法解析 Content-Range: %q", value)
+        }
+        total = parsed
+    }
+    return start, end, total, nil
+}
+
 // ProgressEvent 用于传输进度更新的数据
 type ProgressEvent struct {
     Total      int64
@@ -63,17 +169,27 @@ type ProgressEvent struct {
 // FastDownloader 高速下载器
 type FastDownloader struct {
     config         *DownloadConfig
-    totalSize      int64
-    downloaded     int64
-    lastDownloaded int64
-    startTime      time.Time
-    chunks         []DownloadChunk
     client         *http.Client
     wsClient       *WebSocketClient
     socketClient   *SocketClient
     mutex          sync.Mutex
-    cancel         context.CancelFunc
-    currentURLIndex int           // 当前下载的URL索引
+    runMutex       sync.Mutex               // 保证同一时间只有一个下载批次在运行
+    cancel         context.CancelCauseFunc  // 取消当前批次，原因为 ErrPaused 或 ErrCancelled
+    stateMutex     sync.Mutex
+    state          DownloadState            // 下载器状态，通过 setState 切换
+    runPending     bool                     // 已有开始或恢复请求在等待切换到下载中，由 stateMutex 保护
+    tasks          []*fileTask              // 已开始但尚未完成的文件，按文件索引存放
+    finished       []bool                   // 各文件是否已下载完成，恢复下载时跳过
+    hosts          map[string]*hostThrottle // 各主机的限流状态
+    connections    chan struct{}            // 本下载器的连接预算，未设置 MaxConnections 时为 nil
+    manager        *Manager                 // 所属的下载管理器，直接通过 NewFastDownloader 创建时为 nil
+    rate           *rateLimiter             // 本下载器所有文件共享的限速器
+    scheduleResume chan struct{}            // 被带宽计划暂停时不为 nil，暂停时间段结束时关闭
+    scheduleMutex  sync.Mutex               // 保证同一时间只有一处在应用带宽计划
+    scheduleRule   int                      // 上一次生效的时间段，-1 表示不在任何时间段内
+    scheduleRuns   int                      // 正在运行的下载批次数（runScheduled），为 0 时不检查带宽计划
+    scheduleStop   func()                   // 停止定时检查带宽计划的协程，协程未运行时为 nil
+    clientKey      string                   // client 对应的连接设置（connectionOptions.key），设置变化时重新创建 client
 }
 
 // GetDownloader 创建新的下载器实例（支持多个URL）
@@ -88,19 +204,98 @@ func GetDownloader(urls []string, savePaths []string, threadCount int, chunkSize
     return NewFastDownloader(config)
 }
 
-// NewFastDownloader 创建新的下载器实例
-func NewFastDownloader(config *DownloadConfig) *FastDownloader {
-    transport := &http.Transport{
-        TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+// connectionOptions 影响传输层的连接设置
+type connectionOptions struct {
+    TLS   TLSOptions
+    Proxy ProxyOptions
+}
+
+// key 用于区分不同设置的字符串，下载管理器为相同设置的下载器共享同一个传输层
+func (options connectionOptions) key() string {
+    data, _ := json.Marshal(options)
+    return string(data)
+}
+
+// connectionOptions 获取当前的连接设置
+func (fd *FastDownloader) connectionOptions() connectionOptions {
+    fd.mutex.Lock()
+    defer fd.mutex.Unlock()
+
+    return connectionOptions{TLS: fd.config.TLS, Proxy: fd.config.Proxy}
+}
+
+// newTransport 创建HTTP传输层，所有连接设置都在这里应用，通过 Manager 创建且设置相同的下载器共享同一个
+func newTransport(options connectionOptions) (*http.Transport, error) {
+    tlsClientConfig, err := tlsConfig(options.TLS)
+    if err != nil {
+        return nil, err
     }
-    
-    client := &http.Client{
-        Transport: transport, 
+    proxy, err := proxyFunc(options.Proxy)
+    if err != nil {
+        return nil, err
     }
     
+    return &http.Transport{
+        Proxy:           proxy,
+        TLSClientConfig: tlsClientConfig,
+    }, nil
+}
+
+// newClient 使用新的传输层创建HTTP客户端
+func newClient(options connectionOptions) (*http.Client, error) {
+    transport, err := newTransport(options)
+    if err != nil {
+        return nil, err
+    }
+    return &http.Client{Transport: transport}, nil
+}
+
+// prepareClient 开始下载前按当前的连接设置准备 HTTP 客户端，设置未变化时沿用已有的客户端
+func (fd *FastDownloader) prepareClient() error {
+    options := fd.connectionOptions()
+    key := options.key()
+    fd.mutex.Lock()
+    current := fd.client != nil && fd.clientKey == key
+    fd.mutex.Unlock()
+    if current {
+        return nil
+    }
+
+    var client *http.Client
+    var err error
+    if fd.manager != nil {
+        client, err = fd.manager.clientFor(options)
+    } else {
+        client, err = newClient(options)
+    }
+    if err != nil {
+        return err
+    }
+
+    fd.mutex.Lock()
+    fd.client = client
+    fd.clientKey = key
+    fd.mutex.Unlock()
+    return nil
+}
+
+// NewFastDownloader 创建新的下载器实例，需要与其他下载器共享连接限制时使用 Manager.Add。
+// 证书校验或代理设置无效时在开始下载时报告错误
+func NewFastDownloader(config *DownloadConfig) *FastDownloader {
+    fd := newDownloader(config)
+    options := fd.connectionOptions()
+    if client, err := newClient(options); err == nil {
+        fd.client = client
+        fd.clientKey = options.key()
+    }
+    return fd
+}
+
+// newDownloader 创建还没有 HTTP 客户端的下载器，由调用方设置独立的或共享的客户端
+func newDownloader(config *DownloadConfig) *FastDownloader {
     fd := &FastDownloader{
         config: config,
-        client: client,
+        rate:   newRateLimiter(config.MaxBytesPerSecond),
     }
     
     // 增加更安全的空值检查
@@ -115,8 +310,28 @@ func NewFastDownloader(config *DownloadConfig) *FastDownloader {
     return fd
 }
 
-// StartDownload 启动下载任务（支持多个URL顺序下载）
+// StartDownload 启动下载任务（支持多个URL，设置 MaxConcurrentFiles 时同时下载多个文件）
 func (fd *FastDownloader) StartDownload() error {
+    return fd.runScheduled(false)
+}
+
+// runBatch 下载所有尚未完成的文件，resume 表示从暂停状态恢复
+func (fd *FastDownloader) runBatch(resume bool) error {
+    // 下载中或已有请求在等待时直接拒绝，而不是等上一次运行结束后再下载一遍
+    if err := fd.beginRun(); err != nil {
+        return err
+    }
+    pending := true
+    defer func() {
+        if pending {
+            fd.endRun()
+        }
+    }()
+    
+    // 等待上一次运行（例如刚被暂停的批次）完全退出
+    fd.runMutex.Lock()
+    defer fd.runMutex.Unlock()
+    
     // 验证URL和保存路径数量匹配
     if len(fd.config.URLs) != len(fd.config.SavePaths) {
         SendMessage(fd, Event{
@@ -127,53 +342,123 @@ func (fd *FastDownloader) StartDownload() error {
         })
         return fmt.Errorf("URL数量与保存路径数量不匹配")
     }
+    err := ValidateChecksums(fd.config.Checksums, len(fd.config.URLs))
+    if err == nil {
+        err = validateChecksumSidecar(fd.config.ChecksumSidecar)
+    }
+    if err == nil {
+        err = validateManifests(fd.config.Manifests, len(fd.config.URLs))
+    }
+    if err == nil {
+        err = validateManifestOutput(fd.config.ManifestChunkSize, fd.config.ManifestAlgorithm)
+    }
+    if err == nil {
+        // 带宽计划可以在下载过程中通过 SetSchedule 修改
+        fd.mutex.Lock()
+        schedule := fd.config.Schedule
+        fd.mutex.Unlock()
+        err = ValidateSchedule(schedule)
+    }
+    if err == nil {
+        err = fd.prepareClient()
+    }
+    if err != nil {
+        SendMessage(fd, Event{
+            Type: EventTypeMsg,
+            Name: "错误",
+        }, map[string]interface{}{
+            "Text": err.Error(),
+        })
+        return err
+    }
+    if fd.config.TLS.InsecureSkipVerify {
+        text := "警告: 已关闭服务器证书校验，连接可能被中间人攻击"
+        if fd.config.TLS.pinned() {
+            text = "警告: 已关闭服务器证书校验，只检查服务器证书是否与固定的证书或公钥一致"
+        }
+        SendMessage(fd, Event{
+            Type: EventTypeMsg,
+            Name: "警告",
+        }, map[string]interface{}{
+            "Text": text,
+        })
+    }
+    
+    state := fd.GetState()
+    if resume && state != StatePaused {
+        return fmt.Errorf("只能恢复已暂停的下载，当前状态: %s", state)
+    }
+    if !resume && state == StatePaused {
+        return fmt.Errorf("下载已暂停，请使用恢复下载")
+    }
+    
+    // 先设置取消函数再切换到下载中状态，保证下载中的任务一定可以被暂停或取消
+    ctx, cancel := context.WithCancelCause(context.Background())
+    fd.mutex.Lock()
+    fd.cancel = cancel
+    if !resume || len(fd.finished) != len(fd.config.URLs) {
+        fd.finished = make([]bool, len(fd.config.URLs))
+    }
+    fd.tasks = make([]*fileTask, len(fd.config.URLs))
+    fd.connections = nil
+    if fd.config.MaxConnections > 0 {
+        fd.connections = make(chan struct{}, fd.config.MaxConnections)
+    }
+    fd.mutex.Unlock()
+    defer func() {
+        fd.mutex.Lock()
+        fd.cancel = nil
+        fd.mutex.Unlock()
+        cancel(nil)
+    }()
+    
+    err = fd.setState(StateRunning, fd.currentFileData())
+    fd.endRun()
+    pending = false
+    if err != nil {
+        return err
+    }
+    // 切换到下载中后立即检查带宽计划，在暂停时间段内开始时直接暂停
+    fd.applySchedule()
     
     SendMessage(fd, Event{
         Type: EventTypeStart,
         Name: "开始下载",
     }, map[string]interface{}{})
 
-    // 顺序下载每个URL
-    for i, url := range fd.config.URLs {
-        fd.currentURLIndex = i
-        // 使用局部变量而不是不存在的字段
-        currentURL := url
-        savePath := fd.config.SavePaths[i]
+    failedIndex, err := fd.runFiles(ctx)
+    if err != nil {
+        // 被暂停或取消时以取消原因为准，而不是底层的 context.Canceled
+        if ctx.Err() != nil {
+            err = context.Cause(ctx)
+        }
         
-        // 通知开始下载当前文件
-        SendMessage(fd, Event{
-            Type: EventTypeStartOne,
-            Name: "开始一个下载",
-        }, map[string]interface{}{
-            "URL": url,
-            "Index": i + 1,
-            "Total": len(fd.config.URLs),
-        })
+        // 暂停和取消的状态已由 PauseDownload / CancelDownload 切换
+        if errors.Is(err, ErrPaused) {
+            return err
+        }
         
-        // 执行单个文件下载，传递当前URL和保存路径
-        if err := fd.startSingleDownload(currentURL, savePath); err != nil {
-            SendMessage(fd, Event{
-                Type: EventTypeMsg,
-                Name: "错误",
-            }, map[string]interface{}{
-                "Text": fmt.Sprintf("下载文件失败 %s: %v", url, err),
-            })
+        if errors.Is(err, ErrCancelled) {
+            fd.discardPartial()
             return err
         }
         
-        // 重置下载状态为下一个文件做准备
-        fd.downloaded = 0
-        fd.lastDownloaded = 0
-        fd.totalSize = 0
-        fd.chunks = nil
+        url := fd.config.URLs[failedIndex]
         SendMessage(fd, Event{
-            Type: EventTypeEndOne,
-            Name: "结束一个下载",
+            Type: EventTypeMsg,
+            Name: "错误",
         }, map[string]interface{}{
+            "Text": fmt.Sprintf("下载文件失败 %s: %v", url, err),
+            "FileIndex": failedIndex,
+        })
+        fd.setState(StateFailed, map[string]interface{}{
             "URL": url,
-            "Index": i + 1,
+            "Index": failedIndex + 1,
+            "FileIndex": failedIndex,
             "Total": len(fd.config.URLs),
+            "Text": err.Error(),
         })
+        return err
     }
 
 
@@ -181,16 +466,179 @@ func (fd *FastDownloader) StartDownload() error {
         Type: EventTypeEnd,
         Name: "结束所有下载",
     }, map[string]interface{}{})
+    fd.setState(StateCompleted, nil)
     
     return nil
 }
 
-// startSingleDownload 执行单个文件下载
-func (fd *FastDownloader) startSingleDownload(currentURL string, savePath string) error {
-    // 获取文件大小
-    size, err := fd.getFileSize(currentURL)
+// runFiles 按顺序把未完成的文件分配给 MaxConcurrentFiles 个下载协程，
+// 任意一个文件失败时停止其他文件，返回失败文件的索引和错误
+func (fd *FastDownloader) runFiles(ctx context.Context) (int, error) {
+    concurrency := fd.config.MaxConcurrentFiles
+    if concurrency < 1 {
+        concurrency = 1
+    }
+    
+    ctx, stop := context.WithCancel(ctx)
+    defer stop()
+    
+    var wg sync.WaitGroup
+    var errMutex sync.Mutex
+    failedIndex := -1
+    var firstErr error
+    
+    jobs := make(chan int)
+    for i := 0; i < concurrency; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            for index := range jobs {
+                if err := fd.runFile(ctx, index); err != nil {
+                    errMutex.Lock()
+                    if firstErr == nil {
+                        failedIndex = index
+                        firstErr = err
+                    }
+                    errMutex.Unlock()
+                    stop()
+                }
+            }
+        }()
+    }
+    
+feed:
+    for i := range fd.config.URLs {
+        if fd.isFinished(i) {
+            continue
+        }
+        select {
+        case jobs <- i:
+        case <-ctx.Done():
+            break feed
+        }
+    }
+    close(jobs)
+    wg.Wait()
+    
+    // 还没有分配文件就被暂停或取消时没有任何文件返回错误
+    if firstErr == nil && ctx.Err() != nil {
+        return failedIndex, ctx.Err()
+    }
+    return failedIndex, firstErr
+}
+
+// runFile 下载单个文件，完成后标记为已完成
+func (fd *FastDownloader) runFile(ctx context.Context, index int) error {
+    // 其他文件已失败或下载已暂停时不再开始新文件
+    if err := ctx.Err(); err != nil {
+        return err
+    }
+    
+    task := fd.newFileTask(index)
+    fd.mutex.Lock()
+    fd.tasks[index] = task
+    fd.mutex.Unlock()
+    
+    // 通知开始下载当前文件
+    task.send(Event{
+        Type: EventTypeStartOne,
+        Name: "开始一个下载",
+    }, map[string]interface{}{
+        "URL": task.url,
+        "Index": index + 1,
+        "Total": len(fd.config.URLs),
+    })
+    
+    if err := task.startSingleDownload(ctx, task.url, task.savePath); err != nil {
+        return err
+    }
+    if err := task.verifyChecksum(); err != nil {
+        return err
+    }
+    task.writeManifest()
+    
+    fd.mutex.Lock()
+    fd.finished[index] = true
+    fd.tasks[index] = nil
+    fd.mutex.Unlock()
+    
+    task.send(Event{
+        Type: EventTypeEndOne,
+        Name: "结束一个下载",
+    }, map[string]interface{}{
+        "URL": task.url,
+        "Index": index + 1,
+        "Total": len(fd.config.URLs),
+    })
+    return nil
+}
+
+// isFinished 检查文件是否已下载完成
+func (fd *FastDownloader) isFinished(index int) bool {
+    fd.mutex.Lock()
+    defer fd.mutex.Unlock()
+    
+    return fd.finished[index]
+}
+
+// resetFileState 清空当前文件的下载状态
+func (ft *fileTask) resetFileState() {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+    
+    ft.downloaded = 0
+    ft.startDownloaded = 0
+    ft.totalSize = 0
+    ft.remote = nil
+    ft.partialFile = false
+    ft.singleStream = false
+    ft.chunks = nil
+    ft.pending = nil
+    ft.workers = nil
+    ft.mirrors = nil
+    ft.repairing = nil
+}
+
+// startSingleDownload 执行单个文件下载，远程文件在下载过程中变化时从头重新下载
+func (ft *fileTask) startSingleDownload(ctx context.Context, currentURL string, savePath string) error {
+    for restarts := 0; ; restarts++ {
+        err := ft.downloadFile(ctx, currentURL, savePath)
+        if errors.Is(err, errRangeNotSupported) && !ft.singleStream {
+            // 服务器忽略了 Range，已写入的数据位置不可信，改为单连接从头下载
+            removeResumeState(savePath)
+            ft.resetFileState()
+            ft.singleStream = true
+            ft.send(Event{
+                Type: EventTypeMsg,
+                Name: "警告",
+            }, map[string]interface{}{
+                "Text": "警告: 服务器忽略了 Range 请求，切换为单连接下载",
+            })
+            continue
+        }
+        if !errors.Is(err, errResourceChanged) || restarts >= maxRestarts {
+            return err
+        }
+        
+        // 已下载的数据来自旧版本文件，必须丢弃
+        removeResumeState(savePath)
+        ft.resetFileState()
+        ft.send(Event{
+            Type: EventTypeRestart,
+            Name: "重新下载",
+        }, map[string]interface{}{
+            "URL": currentURL,
+            "Text": "下载过程中远程文件已变化，重新开始下载",
+        })
+    }
+}
+
+// downloadFile 获取远程文件信息并下载单个文件
+func (ft *fileTask) downloadFile(ctx context.Context, currentURL string, savePath string) error {
+    // 获取文件大小，配置了镜像时同时检查各镜像
+    info, err := ft.probeMirrors(ctx, currentURL)
     if err != nil {
-        SendMessage(fd, Event{
+        ft.send(Event{
             Type: EventTypeMsg,
             Name: "错误",
         }, map[string]interface{}{
@@ -198,223 +646,359 @@ func (fd *FastDownloader) startSingleDownload(currentURL string, savePath string
         })
         return fmt.Errorf("获取文件大小失败: %v", err)
     }
-    fd.totalSize = size
-    
-    // 初始化下载块
-    fd.initChunks()
-    
-    // 确保线程数不超过块数
-    actualThreadCount := fd.config.ThreadCount
-    if actualThreadCount > len(fd.chunks) {
-        actualThreadCount = len(fd.chunks)
+    if ft.index < len(ft.fd.config.ExpectedSizes) {
+        if expected := ft.fd.config.ExpectedSizes[ft.index]; expected > 0 && info.Size >= 0 && info.Size != expected {
+            ft.send(Event{
+                Type: EventTypeMsg,
+                Name: "错误",
+            }, map[string]interface{}{
+                "Text": fmt.Sprintf("远程文件大小(%d)与期望大小(%d)不一致", info.Size, expected),
+            })
+            return fmt.Errorf("远程文件大小(%d)与期望大小(%d)不一致", info.Size, expected)
+        }
     }
-    if actualThreadCount <= 0 {
-        actualThreadCount = 1
+    ft.mutex.Lock()
+    ft.totalSize = info.Size
+    ft.remote = info
+    ft.mutex.Unlock()
+    
+    if info.Size < 0 {
+        ft.send(Event{
+            Type: EventTypeMsg,
+            Name: "警告",
+        }, map[string]interface{}{
+            "Text": "警告: 无法获取文件大小，使用单连接流式下载",
+        })
+        return ft.downloadStream(ctx, ft.mirrors[0].URL, savePath)
     }
     
-    // 检查分块大小是否超过文件大小
-    chunkSize := int64(fd.config.ChunkSizeMB) * 1024 * 1024
-    if chunkSize > fd.totalSize && fd.config.ChunkSizeMB > 0 {
-        SendMessage(fd, Event{
+    actualThreadCount := ft.fd.config.ThreadCount
+    
+    if !info.AcceptRanges && !ft.singleStream {
+        ft.singleStream = true
+        ft.send(Event{
             Type: EventTypeMsg,
             Name: "警告",
         }, map[string]interface{}{
-            "Text": fmt.Sprintf("警告: 分块大小(%d MB)超过文件大小(%d bytes)，切换为单线程运行", fd.config.ChunkSizeMB, fd.totalSize),
+            "Text": "警告: 服务器不支持 Range 请求，切换为单连接下载",
         })
+    }
+    
+    // 存在匹配的控制文件时从中恢复块表，修复模式下校验已有文件，否则重新创建目标文件
+    var file *os.File
+    manifest := ft.manifest()
+    state := loadResumeState(savePath)
+    if state != nil && ft.singleStream {
+        // 不支持 Range 时无法从中间继续
+        removeResumeState(savePath)
+        state = nil
+    }
+    if state != nil && state.URL == currentURL && state.changed(info) {
+        // 控制文件记录的是旧版本文件，丢弃后从头下载
+        removeResumeState(savePath)
+        state = nil
+        ft.send(Event{
+            Type: EventTypeRestart,
+            Name: "重新下载",
+        }, map[string]interface{}{
+            "URL": currentURL,
+            "Text": "远程文件已变化，丢弃已下载的数据并重新开始下载",
+        })
+    }
+    if state != nil && state.matches(currentURL, ft.totalSize, savePath) {
+        file, err = os.OpenFile(savePath, os.O_RDWR, 0644)
+        if err != nil {
+            ft.send(Event{
+                Type: EventTypeMsg,
+                Name: "错误",
+            }, map[string]interface{}{
+                "Text": fmt.Sprintf("打开文件失败: %v", err),
+            })
+            return fmt.Errorf("打开文件失败: %v", err)
+        }
+        ft.restoreChunks(state)
+        ft.send(Event{
+            Type: EventTypeMsg,
+            Name: "断点续传",
+        }, map[string]interface{}{
+            "Text": fmt.Sprintf("从控制文件恢复下载，已完成 %d/%d 字节", ft.downloaded, ft.totalSize),
+        })
+    } else if ft.fd.config.Repair && manifest != nil && ft.canRepair(savePath, manifest) {
+        file, err = ft.openForRepair(savePath, manifest)
+        if err != nil {
+            return err
+        }
+    } else {
+        file, err = ft.createTargetFile(savePath)
+        if err != nil {
+            return err
+        }
+        
+        // 初始化下载块
+        ft.initChunks()
+        
+        // 检查分块大小是否超过文件大小
+        chunkSize := int64(ft.fd.config.ChunkSizeMB) * 1024 * 1024
+        if ft.singleStream {
+            ft.chunks = []*DownloadChunk{{
+                StartOffset: 0,
+                EndOffset:   ft.totalSize - 1,
+                Done:        false,
+            }}
+        } else if chunkSize > ft.totalSize && ft.fd.config.ChunkSizeMB > 0 {
+            ft.send(Event{
+                Type: EventTypeMsg,
+                Name: "警告",
+            }, map[string]interface{}{
+                "Text": fmt.Sprintf("警告: 分块大小(%d MB)超过文件大小(%d bytes)，作为单个块下载，由空闲线程拆分", ft.fd.config.ChunkSizeMB, ft.totalSize),
+            })
+            // 重新初始化chunks为单个块
+            ft.chunks = []*DownloadChunk{{
+                StartOffset: 0,
+                EndOffset:   ft.totalSize - 1,
+                Done:        false,
+            }}
+        }
+    }
+    defer file.Close()
+    ft.partialFile = true
+    
+    // 线程数可以多于块数，多出的线程会拆分正在下载的块；单连接下载时只能使用一个线程
+    if ft.singleStream {
         actualThreadCount = 1
-        // 重新初始化chunks为单个块
-        fd.chunks = []DownloadChunk{{
-            StartOffset: 0,
-            EndOffset:   fd.totalSize - 1,
-            Done:        false,
-        }}
+    }
+    if actualThreadCount <= 0 {
+        actualThreadCount = 1
+    }
+    
+    // 通知开始下载
+    ft.startTime = time.Now()
+    ft.startDownloaded = ft.downloaded
+    ft.notifyProgress(ft.totalSize, ft.downloaded)
+    
+    // 固定数量的工作线程从队列中领取块，直到所有块下载完成
+    stopAutoSave := ft.startAutoSave(file, currentURL, savePath)
+    err = ft.runWorkers(ctx, file, actualThreadCount)
+    stopAutoSave()
+    if err != nil {
+        // 保留已下载的数据，下次启动时从控制文件继续
+        if saveErr := ft.saveResumeState(file, currentURL, savePath); saveErr != nil {
+            ft.send(Event{
+                Type: EventTypeMsg,
+                Name: "警告",
+            }, map[string]interface{}{
+                "Text": fmt.Sprintf("保存控制文件失败: %v", saveErr),
+            })
+        }
+        return err
+    }
+    removeResumeState(savePath)
+    if manifest != nil {
+        if err := ft.confirmRepair(file, manifest); err != nil {
+            return err
+        }
     }
     
+    // 通知下载完成
+    ft.notifyProgress(ft.totalSize, ft.downloaded)
+    return nil
+}
+
+// createTargetFile 创建目标文件并预分配大小
+func (ft *fileTask) createTargetFile(savePath string) (*os.File, error) {
     // 创建目标文件
     file, err := os.Create(savePath)
     if err != nil {
-        SendMessage(fd, Event{
+        ft.send(Event{
             Type: EventTypeMsg,
             Name: "错误",
         }, map[string]interface{}{
             "Text": fmt.Sprintf("创建文件失败: %v", err),
         })
-        return fmt.Errorf("创建文件失败: %v", err)
+        return nil, fmt.Errorf("创建文件失败: %v", err)
     }
-    defer file.Close()
     
-    // 设置文件大小
-    if err := file.Truncate(fd.totalSize); err != nil {
-        SendMessage(fd, Event{
+    // 设置文件大小（大小未知时从空文件开始顺序写入）
+    size := ft.totalSize
+    if size < 0 {
+        size = 0
+    }
+    if err := file.Truncate(size); err != nil {
+        file.Close()
+        ft.send(Event{
             Type: EventTypeMsg,
             Name: "错误",
         }, map[string]interface{}{
             "Text": fmt.Sprintf("设置文件大小失败: %v", err),
         })
-        return fmt.Errorf("设置文件大小失败: %v", err)
+        return nil, fmt.Errorf("设置文件大小失败: %v", err)
     }
     
-    // 通知开始下载
-    fd.startTime = time.Now()
-    fd.notifyProgress(0, 0)
-    
-    // 移除超时控制，直接创建上下文
-    ctx := context.Background()
-    
-    // 并发下载
-    var wg sync.WaitGroup
-    errChan := make(chan error, actualThreadCount)
-    
-    for i := 0; i < actualThreadCount; i++ {
-        wg.Add(1)
-        go func(chunkIndex int) {
-            defer wg.Done()
-            if err := fd.downloadChunk(ctx, file, chunkIndex, currentURL); err != nil {
-                select {
-                case errChan <- err:
-                default:
-                }
-            }
-        }(i)
-    }
-    
-    // 等待所有goroutine完成
-    wg.Wait()
-    close(errChan)
-    
-    // 检查是否有错误
-    if len(errChan) > 0 {
-        return <-errChan
-    }
-    
-    // 通知下载完成
-    fd.notifyProgress(fd.totalSize, fd.downloaded)
-    return nil
+    return file, nil
 }
 
-// getFileSize 获取文件大小
-func (fd *FastDownloader) getFileSize(url string) (int64, error) {
-    req, err := http.NewRequest("HEAD", url, nil)
+// headFileInfo 通过 HEAD 请求获取文件大小以及用于校验文件是否变化的 ETag、Last-Modified
+func (fd *FastDownloader) headFileInfo(ctx context.Context, url string) (*RemoteFileInfo, error) {
+    req, err := http.NewRequestWithContext(ctx, "HEAD", url, nil)
     if err != nil {
-        return 0, err
+        return nil, err
     }
     
     resp, err := fd.client.Do(req)
     if err != nil {
-        return 0, err
+        return nil, err
     }
     defer resp.Body.Close()
     
+    // HEAD 失败时由 getFileSize 改用 GET 探测，这里只返回错误
     if resp.StatusCode != http.StatusOK {
-        SendMessage(fd, Event {
-            Type: EventTypeMsg,
-            Name: "错误",
-        }, map[string]interface{}{
-            "Text": fmt.Sprintf("HTTP错误: %d\n", resp.StatusCode),
-        })
-        return 0, fmt.Errorf("HTTP错误: %d", resp.StatusCode)
+        return nil, fmt.Errorf("HTTP错误: %d", resp.StatusCode)
     }
     
     contentLength := resp.Header.Get("Content-Length")
     if contentLength == "" {
-        SendMessage(fd, Event {
-            Type: EventTypeMsg,
-            Name: "错误",
-        }, map[string]interface{}{
-            "Text": fmt.Sprintf("无法获取文件大小:%d\n", resp.StatusCode),
-        })
-        return 0, fmt.Errorf("无法获取文件大小")
+        return nil, fmt.Errorf("无法获取文件大小")
     }
     
     size, err := strconv.ParseInt(contentLength, 10, 64)
     if err != nil {
-        SendMessage(fd, Event {
-            Type: EventTypeMsg,
-            Name: "错误",
-        }, map[string]interface{}{
-            "Text": fmt.Sprintf("解析文件大小失败:%v\n", err),
-        })
-        return 0, fmt.Errorf("解析文件大小失败: %v", err)
+        return nil, fmt.Errorf("解析文件大小失败: %v", err)
     }
     
-    return size, nil
+    // 没有 Accept-Ranges 的服务器也可能支持 Range，由块请求的响应进一步确认
+    return &RemoteFileInfo{
+        Size:         size,
+        ETag:         resp.Header.Get("ETag"),
+        LastModified: resp.Header.Get("Last-Modified"),
+        AcceptRanges: !strings.EqualFold(strings.TrimSpace(resp.Header.Get("Accept-Ranges")), "none"),
+        Digests:      parseDigests(resp.Header, false),
+    }, nil
 }
 
 // initChunks 初始化下载块
-func (fd *FastDownloader) initChunks() {
-    chunkSize := int64(fd.config.ChunkSizeMB) * 1024 * 1024
+func (ft *fileTask) initChunks() {
+    chunkSize := int64(ft.fd.config.ChunkSizeMB) * 1024 * 1024
     if chunkSize <= 0 {
-        chunkSize = fd.totalSize / int64(fd.config.ThreadCount)
+        chunkSize = ft.totalSize / int64(ft.fd.config.ThreadCount)
         if chunkSize == 0 {
-            chunkSize = fd.totalSize
+            chunkSize = ft.totalSize
         }
     }
     
-    var chunks []DownloadChunk
-    for i := int64(0); i < fd.totalSize; i += chunkSize {
+    var chunks []*DownloadChunk
+    for i := int64(0); i < ft.totalSize; i += chunkSize {
         end := i + chunkSize - 1
-        if end >= fd.totalSize {
-            end = fd.totalSize - 1
+        if end >= ft.totalSize {
+            end = ft.totalSize - 1
         }
-        chunks = append(chunks, DownloadChunk{
+        chunks = append(chunks, &DownloadChunk{
             StartOffset: i,
             EndOffset:   end,
             Done:        false,
         })
     }
     
-    fd.chunks = chunks
+    ft.chunks = chunks
 }
 
-// downloadChunk 下载指定块
-func (fd *FastDownloader) downloadChunk(ctx context.Context, file *os.File, chunkIndex int, url string) error {
-    chunk := &fd.chunks[chunkIndex]
-    if chunk.Done {
+// downloadChunk 从指定镜像下载指定块
+func (ft *fileTask) downloadChunk(ctx context.Context, file *os.File, chunkIndex int, m *mirror, worker *WorkerStat) error {
+    ft.mutex.Lock()
+    chunk := ft.chunks[chunkIndex]
+    done := chunk.Done
+    offset := chunk.StartOffset + chunk.Downloaded
+    end := chunk.EndOffset
+    if !done && offset > end {
+        // 已写完但还没来得及标记完成的块（例如在此期间保存了控制文件），不需要再请求
+        chunk.Done = true
+        done = true
+    }
+    ft.mutex.Unlock()
+    if done {
         return nil
     }
     
-    req, err := http.NewRequest("GET", url, nil)
+    if ft.singleStream && offset > 0 {
+        // 不支持 Range 时只能从头重新下载
+        ft.mutex.Lock()
+        atomic.AddInt64(&ft.downloaded, -chunk.Downloaded)
+        chunk.Downloaded = 0
+        ft.mutex.Unlock()
+        offset = 0
+    }
+    
+    req, err := http.NewRequestWithContext(ctx, "GET", m.URL, nil)
     if err != nil {
-        // fmt.Printf("Error creating request for chunk %d: %v\n", chunkIndex, err)
-        SendMessage(fd, Event {
-            Type: EventTypeMsg,
-            Name: "错误",
-        }, map[string]interface{}{
-            "Text": fmt.Sprintf("创建块请求失败:%d: %v\n", chunkIndex, err),
-        })
+        return fmt.Errorf("创建块请求失败: %w", err)
+    }
+    
+    ifRange := ""
+    if !ft.singleStream {
+        rangeHeader := fmt.Sprintf("bytes=%d-%d", offset, end)
+        req.Header.Set("Range", rangeHeader)
+        // 远程文件变化时服务器会返回完整文件（200），避免混入新旧两个版本的数据
+        ifRange = m.Info.ifRange()
+        if ifRange != "" {
+            req.Header.Set("If-Range", ifRange)
+        }
+    }
+    
+    // 被限流的主机会降低并发连接数
+    host := hostOf(m.URL)
+    if err := ft.fd.acquireHost(ctx, host); err != nil {
         return err
     }
+    defer ft.fd.releaseHost(host)
     
-    rangeHeader := fmt.Sprintf("bytes=%d-%d", chunk.StartOffset, chunk.EndOffset)
-    req.Header.Set("Range", rangeHeader)
+    // 所有文件共享连接预算，通过 Manager 创建时还受全局连接数限制
+    if err := ft.fd.acquireConnection(ctx, host); err != nil {
+        return err
+    }
+    defer ft.fd.releaseConnection(host)
     
-    resp, err := fd.client.Do(req)
+    // 请求和状态码错误由 downloadChunkWithRetry 决定是否重试
+    requestStart := time.Now()
+    resp, err := ft.fd.client.Do(req)
     if err != nil {
-        // fmt.Printf("Error downloading chunk %d: %v\n", chunkIndex, err)
-        SendMessage(fd, Event {
-            Type: EventTypeMsg,
-            Name: "错误",
-        }, map[string]interface{}{
-            "Text": fmt.Sprintf("下载块失败:%d: %v\n", chunkIndex, err),
-        })
         return err
     }
     defer resp.Body.Close()
     
+    // 统计镜像的响应延迟和吞吐量，用于选择镜像
+    ft.recordMirrorLatency(m, time.Since(requestStart))
+    var received int64
+    bodyStart := time.Now()
+    defer func() {
+        ft.recordMirrorTransfer(m, received, time.Since(bodyStart))
+    }()
+    
     if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
-        // fmt.Printf("HTTP error for chunk %d: %d\n", chunkIndex, resp.StatusCode)
-        SendMessage(fd, Event {
-            Type: EventTypeMsg,
-            Name: "错误",
-        }, map[string]interface{}{
-            "Text": fmt.Sprintf("下载块失败:%d: HTTP错误: %d\n", chunkIndex, resp.StatusCode),
-        })
-        return fmt.Errorf("HTTP错误: %d", resp.StatusCode)
+        return &httpStatusError{
+            StatusCode: resp.StatusCode,
+            RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+        }
+    }
+    
+    if resp.StatusCode == http.StatusOK && !ft.singleStream {
+        // 带 If-Range 时返回 200 可能是文件已变化，也可能是服务器忽略了 Range
+        if ifRange != "" && m.Info.changedFrom(resp.Header) {
+            return errResourceChanged
+        }
+        return errRangeNotSupported
+    }
+    
+    if resp.StatusCode == http.StatusPartialContent {
+        start, rangeEnd, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+        if err != nil {
+            return err
+        }
+        if start != offset || rangeEnd > end || (total >= 0 && total != ft.totalSize) {
+            return fmt.Errorf("%w: 请求 %d-%d/%d，响应 %s", errInvalidContentRange, offset, end, ft.totalSize, resp.Header.Get("Content-Range"))
+        }
     }
     
     // 写入文件
     buffer := make([]byte, 64*1024) // 64KB缓冲区
-    offset := chunk.StartOffset
     
     for {
         select {
@@ -425,23 +1009,42 @@ func (fd *FastDownloader) downloadChunk(ctx context.Context, file *os.File, chun
         
         n, err := resp.Body.Read(buffer)
         if n > 0 {
-            fd.mutex.Lock()
+            // 限速时等待令牌，等待期间可以被暂停或取消
+            if rateErr := ft.fd.waitRate(ctx, host, n); rateErr != nil {
+                return rateErr
+            }
+            
+            ft.mutex.Lock()
+            // 块可能已被空闲线程拆分，只写入仍属于本块的部分
+            if remaining := chunk.EndOffset - offset + 1; int64(n) > remaining {
+                n = int(remaining)
+            }
             _, writeErr := file.WriteAt(buffer[:n], offset)
-            fd.mutex.Unlock()
+            if writeErr == nil {
+                chunk.Downloaded += int64(n)
+                worker.Downloaded += int64(n)
+            }
+            finished := offset+int64(n) > chunk.EndOffset
+            ft.mutex.Unlock()
             
             if writeErr != nil {
                 return writeErr
             }
             
             offset += int64(n)
-            atomic.AddInt64(&fd.downloaded, int64(n))
+            received += int64(n)
+            atomic.AddInt64(&ft.downloaded, int64(n))
             
             // 通知进度更新
-            currentDownloaded := atomic.LoadInt64(&fd.downloaded)
-            if currentDownloaded > fd.totalSize {
-                currentDownloaded = fd.totalSize
+            currentDownloaded := atomic.LoadInt64(&ft.downloaded)
+            if currentDownloaded > ft.totalSize {
+                currentDownloaded = ft.totalSize
+            }
+            ft.notifyProgress(ft.totalSize, currentDownloaded)
+            
+            if finished {
+                break
             }
-            fd.notifyProgress(fd.totalSize, currentDownloaded)
         }
         
         if err == io.EOF {
@@ -452,34 +1055,46 @@ func (fd *FastDownloader) downloadChunk(ctx context.Context, file *os.File, chun
         }
     }
     
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+    // 连接提前结束时块还没有写完，交给重试从当前位置继续
+    if offset <= chunk.EndOffset {
+        return errShortRead
+    }
     chunk.Done = true
     return nil
 }
 
 // notifyProgress 通知进度更新
-func (fd *FastDownloader) notifyProgress(total int64, downloaded int64) {
+func (ft *fileTask) notifyProgress(total int64, downloaded int64) {
+    // 多个工作线程会同时上报进度，需要串行化增量计算
+    ft.progressMutex.Lock()
+    defer ft.progressMutex.Unlock()
+
     var speed float64
-    elapsed := time.Since(fd.startTime).Seconds()
+    elapsed := time.Since(ft.startTime).Seconds()
 
     if elapsed > 0 {
-        speed = float64(downloaded) / elapsed
+        speed = float64(downloaded-ft.startDownloaded) / elapsed
     }
     
-    // 添加检查，防止超过总量
-    if downloaded > total {
+    // 添加检查，防止超过总量（总大小未知时 total 为 -1）
+    if total >= 0 && downloaded > total {
         downloaded = total
     }
 
-    added := downloaded - fd.lastDownloaded
-    fd.lastDownloaded = downloaded
+    added := downloaded - ft.lastDownloaded
+    ft.lastDownloaded = downloaded
     
-    SendMessage(fd, Event {
+    ft.send(Event {
         Type: EventTypeUpdate,
         Name: "update",
     }, map[string]interface{}{
         "Total": total,
         "Added": added,
         "Speed": speed,
+        "Workers": ft.workerSnapshot(),
+        "Mirrors": ft.mirrorSnapshot(),
     })
     
 }
@@ -519,14 +1134,93 @@ func SendMessage(fd *FastDownloader, event Event, msg interface{}) error {
     }
 }
 
-// PauseDownload 暂停下载
-func (fd *FastDownloader) PauseDownload() {
-    if fd.cancel != nil {
-        fd.cancel()
+// PauseDownload 暂停下载，已下载的数据保存在控制文件中，可通过 ResumeDownload 继续
+func (fd *FastDownloader) PauseDownload() error {
+    fd.mutex.Lock()
+    cancel := fd.cancel
+    fd.mutex.Unlock()
+    
+    if cancel == nil {
+        return fmt.Errorf("下载未在进行中")
+    }
+    if err := fd.setState(StatePaused, fd.currentFileData()); err != nil {
+        return err
+    }
+    cancel(ErrPaused)
+    return nil
+}
+
+// currentFileData 当前下载文件的事件数据，同时下载多个文件时为索引最小的未完成文件
+func (fd *FastDownloader) currentFileData() map[string]interface{} {
+    fd.mutex.Lock()
+    index := len(fd.config.URLs)
+    var task *fileTask
+    for i, t := range fd.tasks {
+        if t != nil {
+            index = i
+            task = t
+            break
+        }
     }
+    if task == nil {
+        for i := range fd.config.URLs {
+            if i >= len(fd.finished) || !fd.finished[i] {
+                index = i
+                break
+            }
+        }
+    }
+    fd.mutex.Unlock()
+    
+    if task != nil {
+        return task.fileData()
+    }
+    data := map[string]interface{}{
+        "Index": index + 1,
+        "FileIndex": index,
+        "Total": len(fd.config.URLs),
+        "Downloaded": int64(0),
+        "Size": int64(0),
+    }
+    if index < len(fd.config.URLs) {
+        data["URL"] = fd.config.URLs[index]
+    }
+    return data
 }
 
-// ResumeDownload 恢复下载
+// ResumeDownload 恢复已暂停的下载，跳过已完成的文件，已下载的部分从控制文件恢复
 func (fd *FastDownloader) ResumeDownload() error {
-    return fd.StartDownload()
+    return fd.runScheduled(true)
+}
+
+// CancelDownload 取消下载中或已暂停的下载，删除所有未完成的文件和控制文件
+func (fd *FastDownloader) CancelDownload() error {
+    data := fd.currentFileData()
+    
+    // 正在下载时由下载协程负责清理
+    if fd.GetState() == StateRunning {
+        fd.mutex.Lock()
+        cancel := fd.cancel
+        fd.mutex.Unlock()
+        if err := fd.setState(StateCancelled, data); err != nil {
+            return err
+        }
+        if cancel != nil {
+            cancel(ErrCancelled)
+        }
+        return nil
+    }
+    
+    // 等待刚被暂停的批次完全退出后再清理
+    fd.runMutex.Lock()
+    defer fd.runMutex.Unlock()
+    
+    if fd.GetState() != StatePaused {
+        return fmt.Errorf("没有可取消的下载")
+    }
+    if err := fd.setState(StateCancelled, data); err != nil {
+        return err
+    }
+    fd.discardPartial()
+    return nil
 }
\ No newline at end of file
@@ -17,12 +17,52 @@ static void call_progress_callback(progress_callback_t callback, void* event, vo
 import "C"
 import (
     "encoding/json"
+    "errors"
     "fmt"
+    "strings"
+    "time"
     "unsafe"
 )
 
-var downloaders = make(map[int]*FastDownloader)
-var downloaderID = 0
+// cStringArray 将C字符串数组转换为Go字符串切片
+func cStringArray(array **C.char, count C.int) []string {
+    if array == nil || count <= 0 {
+        return []string{}
+    }
+
+    result := make([]string, 0, int(count))
+    for _, ptr := range unsafe.Slice(array, int(count)) {
+        result = append(result, C.GoString(ptr))
+    }
+    return result
+}
+
+// pemOrPath 区分PEM内容和文件路径：包含 "-----BEGIN" 时视为PEM内容，否则视为文件路径，NULL 时都为空
+func pemOrPath(value *C.char) (string, string) {
+    if value == nil {
+        return "", ""
+    }
+    str := C.GoString(value)
+    if strings.Contains(str, "-----BEGIN") {
+        return str, ""
+    }
+    return "", str
+}
+
+// downloadResultCode 将下载结果转换为C接口返回值：
+// 0 成功，1 已暂停，2 已取消，-1 失败
+func downloadResultCode(err error) C.int {
+    switch {
+    case err == nil:
+        return 0
+    case errors.Is(err, ErrPaused):
+        return 1
+    case errors.Is(err, ErrCancelled):
+        return 2
+    default:
+        return -1
+    }
+}
 
 //export startMultiDownload
 func startMultiDownload(
@@ -38,23 +78,10 @@ func startMultiDownload(
     useSocket *C._Bool,
 ) C.int {
     // 转换URL数组
-    urlsSlice := make([]string, int(urlCount))
-    urlPtr := uintptr(unsafe.Pointer(urls))
-    for i := 0; i < int(urlCount); i++ {
-        ptr := *(**C.char)(unsafe.Pointer(urlPtr + uintptr(i)*unsafe.Sizeof((*C.char)(nil))))
-        urlStr := C.GoString(ptr)
-        urlsSlice[i] = urlStr
-    }
+    urlsSlice := cStringArray(urls, urlCount)
     
     // 转换保存路径数组
-    pathsSlice := make([]string, int(pathCount))
-    pathPtr := uintptr(unsafe.Pointer(savePaths))
-    for i := 0; i < int(pathCount); i++ {
-        // pathStr := C.GoString((**C.char)(unsafe.Pointer(pathPtr + uintptr(i)*unsafe.Sizeof(uintptr(0))))[0])
-        ptr := *(**C.char)(unsafe.Pointer(pathPtr + uintptr(i)*unsafe.Sizeof((*C.char)(nil))))
-        pathStr := C.GoString(ptr)
-        pathsSlice[i] = pathStr
-    }
+    pathsSlice := cStringArray(savePaths, pathCount)
     
     var callbackURL *string
     if remoteCallbackUrl != nil && C.GoString(remoteCallbackUrl) != "" {
@@ -100,9 +127,7 @@ func startMultiDownload(
         }
     }
     
-    downloader := NewFastDownloader(config)
-    downloaderID++
-    downloaders[downloaderID] = downloader
+    downloaderID, downloader := defaultManager.Add(config)
     
     err := downloader.StartDownload()
     if err != nil {
@@ -172,9 +197,7 @@ func startDownload(
         }
     }
     
-    downloader := NewFastDownloader(config)
-    downloaderID++
-    downloaders[downloaderID] = downloader
+    downloaderID, downloader := defaultManager.Add(config)
     
     err := downloader.StartDownload()
     if err != nil {
@@ -195,22 +218,10 @@ func getDownloader(
     chunkSizeMB C.int,
 ) C.int {
     // 转换URL数组
-    urlsSlice := make([]string, int(urlCount))
-    urlPtr := uintptr(unsafe.Pointer(urls))
-    for i := 0; i < int(urlCount); i++ {
-        ptr := *(**C.char)(unsafe.Pointer(urlPtr + uintptr(i)*unsafe.Sizeof((*C.char)(nil))))
-        urlStr := C.GoString(ptr)
-        urlsSlice[i] = urlStr
-    }
+    urlsSlice := cStringArray(urls, urlCount)
     
     // 转换保存路径数组
-    pathsSlice := make([]string, int(pathCount))
-    pathPtr := uintptr(unsafe.Pointer(savePaths))
-    for i := 0; i < int(pathCount); i++ {
-        ptr := *(**C.char)(unsafe.Pointer(pathPtr + uintptr(i)*unsafe.Sizeof((*C.char)(nil))))
-        pathStr := C.GoString(ptr)
-        pathsSlice[i] = pathStr
-    }
+    pathsSlice := cStringArray(savePaths, pathCount)
     
     config := &DownloadConfig{
         URLs:        urlsSlice,
@@ -219,36 +230,525 @@ func getDownloader(
         ChunkSizeMB: int(chunkSizeMB),
     }
     
-    downloader := NewFastDownloader(config)
-    downloaderID++
-    downloaders[downloaderID] = downloader
+    downloaderID, _ := defaultManager.Add(config)
+    
+    return C.int(downloaderID)
+}
+
+//export loadMetalink
+func loadMetalink(
+    metalinkPath *C.char,    // .meta4 文件路径
+    saveDir *C.char,         // 保存目录
+    threadCount C.int,
+    chunkSizeMB C.int,
+) C.int {
+    if metalinkPath == nil || saveDir == nil {
+        return -1
+    }
+
+    config, err := LoadMetalink(C.GoString(metalinkPath), C.GoString(saveDir))
+    if err != nil {
+        fmt.Printf("加载 Metalink 失败：%v\n", err)
+        return -1
+    }
+    config.ThreadCount = int(threadCount)
+    config.ChunkSizeMB = int(chunkSizeMB)
+    
+    downloaderID, _ := defaultManager.Add(config)
     
     return C.int(downloaderID)
 }
 
+//export startDownloadByID
+func startDownloadByID(id C.int) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // 阻塞直到下载结束、暂停或取消，需要暂停时请在其他线程中调用
+    return downloadResultCode(downloader.StartDownload())
+}
+
+//export setRetryPolicy
+func setRetryPolicy(id C.int, maxRetries C.int, baseDelayMs C.int, maxDelayMs C.int) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // 下载中或已暂停时不能修改
+    err := downloader.configure(func(config *DownloadConfig) {
+        config.MaxRetries = int(maxRetries)
+        config.RetryBaseDelay = time.Duration(baseDelayMs) * time.Millisecond
+        config.RetryMaxDelay = time.Duration(maxDelayMs) * time.Millisecond
+    })
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setThrottleAllChunks
+func setThrottleAllChunks(id C.int, throttleAll C._Bool) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // 下载中或已暂停时不能修改
+    err := downloader.configure(func(config *DownloadConfig) {
+        config.ThrottleAllChunks = bool(throttleAll)
+    })
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setConcurrency
+func setConcurrency(id C.int, maxFiles C.int, maxConnections C.int) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // 下载中或已暂停时不能修改
+    err := downloader.configure(func(config *DownloadConfig) {
+        config.MaxConcurrentFiles = int(maxFiles)
+        config.MaxConnections = int(maxConnections)
+    })
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setMirrors
+func setMirrors(id C.int, index C.int, mirrors **C.char, mirrorCount C.int) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+    if index < 0 || int(index) >= len(downloader.config.URLs) {
+        return -1
+    }
+
+    // 转换镜像地址数组
+    mirrorsSlice := cStringArray(mirrors, mirrorCount)
+
+    // 下载中或已暂停时不能修改
+    err := downloader.configure(func(config *DownloadConfig) {
+        for len(config.Mirrors) < len(config.URLs) {
+            config.Mirrors = append(config.Mirrors, nil)
+        }
+        config.Mirrors[int(index)] = mirrorsSlice
+    })
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setChecksum
+func setChecksum(id C.int, index C.int, checksum *C.char) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+    if index < 0 || int(index) >= len(downloader.config.URLs) {
+        return -1
+    }
+
+    // 格式为 "算法:十六进制值"，NULL 或空字符串表示不校验
+    var spec string
+    if checksum != nil {
+        spec = C.GoString(checksum)
+    }
+    if _, _, err := parseChecksum(spec); err != nil {
+        return -1
+    }
+
+    // 下载中或已暂停时不能修改
+    err := downloader.configure(func(config *DownloadConfig) {
+        for len(config.Checksums) < len(config.URLs) {
+            config.Checksums = append(config.Checksums, "")
+        }
+        config.Checksums[int(index)] = spec
+    })
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setDeleteOnChecksumMismatch
+func setDeleteOnChecksumMismatch(id C.int, deleteFile C._Bool) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // 下载中或已暂停时不能修改
+    err := downloader.configure(func(config *DownloadConfig) {
+        config.DeleteOnChecksumMismatch = bool(deleteFile)
+    })
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setAutoVerify
+func setAutoVerify(id C.int, sidecarExtension *C.char, useServerDigests C._Bool) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // sidecarExtension 为 NULL 或空字符串表示不获取校验文件
+    var extension string
+    if sidecarExtension != nil {
+        extension = C.GoString(sidecarExtension)
+    }
+    if err := validateChecksumSidecar(extension); err != nil {
+        return -1
+    }
+
+    // 下载中或已暂停时不能修改
+    err := downloader.configure(func(config *DownloadConfig) {
+        config.ChecksumSidecar = extension
+        config.IgnoreServerDigests = !bool(useServerDigests)
+    })
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setManifest
+func setManifest(id C.int, index C.int, manifestPath *C.char) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+    if index < 0 || int(index) >= len(downloader.config.URLs) {
+        return -1
+    }
+
+    // manifestPath 为 NULL 或空字符串表示清除块哈希清单
+    var manifest *ChunkManifest
+    if manifestPath != nil && C.GoString(manifestPath) != "" {
+        loaded, err := LoadManifest(C.GoString(manifestPath))
+        if err != nil {
+            return -1
+        }
+        manifest = loaded
+    }
+
+    // 下载中或已暂停时不能修改
+    err := downloader.configure(func(config *DownloadConfig) {
+        for len(config.Manifests) < len(config.URLs) {
+            config.Manifests = append(config.Manifests, nil)
+        }
+        config.Manifests[int(index)] = manifest
+    })
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setRepairMode
+func setRepairMode(id C.int, repair C._Bool) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // 下载中或已暂停时不能修改
+    err := downloader.configure(func(config *DownloadConfig) {
+        config.Repair = bool(repair)
+    })
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setManifestOutput
+func setManifestOutput(id C.int, chunkSize C.longlong, algorithm *C.char) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // algorithm 为 NULL 或空字符串时使用 sha256
+    var algorithmStr string
+    if algorithm != nil {
+        algorithmStr = C.GoString(algorithm)
+    }
+    if err := validateManifestOutput(int64(chunkSize), algorithmStr); err != nil {
+        return -1
+    }
+
+    // 下载中或已暂停时不能修改
+    err := downloader.configure(func(config *DownloadConfig) {
+        config.ManifestChunkSize = int64(chunkSize)
+        config.ManifestAlgorithm = algorithmStr
+    })
+    if err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setTLSConfig
+func setTLSConfig(id C.int, options *C.char) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // options 为 TLSOptions 的 JSON 对象，NULL 表示恢复默认（使用系统根证书校验）
+    var tlsOptions TLSOptions
+    if options != nil {
+        if err := json.Unmarshal([]byte(C.GoString(options)), &tlsOptions); err != nil {
+            return -1
+        }
+    }
+    if err := downloader.SetTLSOptions(tlsOptions); err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setClientCertificate
+func setClientCertificate(id C.int, certificate *C.char, key *C.char, password *C.char) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // certificate 和 key 可以是 PEM 文件路径或 PEM 内容，certificate 为 NULL 时清除客户端证书，
+    // 其他证书校验设置保持不变
+    options := downloader.config.TLS
+    options.ClientCertPEM, options.ClientCertFile = pemOrPath(certificate)
+    options.ClientKeyPEM, options.ClientKeyFile = pemOrPath(key)
+    options.KeyPassword = ""
+    if password != nil {
+        options.KeyPassword = C.GoString(password)
+    }
+    if certificate == nil {
+        options.ClientKeyPEM, options.ClientKeyFile, options.KeyPassword = "", "", ""
+    }
+    if err := downloader.SetTLSOptions(options); err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setProxy
+func setProxy(id C.int, proxyURL *C.char, noProxy *C.char) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // proxyURL 为 NULL 或空字符串时使用环境变量，noProxy 为逗号分隔的主机列表
+    var options ProxyOptions
+    if proxyURL != nil {
+        options.URL = C.GoString(proxyURL)
+    }
+    if noProxy != nil {
+        for _, host := range strings.Split(C.GoString(noProxy), ",") {
+            if host = strings.TrimSpace(host); host != "" {
+                options.NoProxy = append(options.NoProxy, host)
+            }
+        }
+    }
+    if err := downloader.SetProxy(options); err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setGlobalLimits
+func setGlobalLimits(maxConnections C.int, maxPerHost C.int) C.int {
+    if maxConnections < 0 || maxPerHost < 0 {
+        return -1
+    }
+
+    // 对所有下载器生效，下载过程中也可以调整
+    defaultManager.SetLimits(int(maxConnections), int(maxPerHost))
+    return 0
+}
+
+//export removeDownloader
+func removeDownloader(id C.int) C.int {
+    if err := defaultManager.Remove(int(id)); err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setRateLimit
+func setRateLimit(id C.int, bytesPerSecond C.longlong) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists || bytesPerSecond < 0 {
+        return -1
+    }
+
+    // 下载过程中也可以调整
+    downloader.SetRateLimit(int64(bytesPerSecond))
+    return 0
+}
+
+//export setGlobalRateLimit
+func setGlobalRateLimit(bytesPerSecond C.longlong) C.int {
+    if bytesPerSecond < 0 {
+        return -1
+    }
+
+    defaultManager.SetRateLimit(int64(bytesPerSecond))
+    return 0
+}
+
+//export setHostRateLimit
+func setHostRateLimit(host *C.char, bytesPerSecond C.longlong) C.int {
+    if host == nil || bytesPerSecond < 0 {
+        return -1
+    }
+
+    defaultManager.SetHostRateLimit(C.GoString(host), int64(bytesPerSecond))
+    return 0
+}
+
+//export setBandwidthSchedule
+func setBandwidthSchedule(id C.int, schedule *C.char) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    // schedule 为 BandwidthRule 的 JSON 数组，NULL 或空数组表示清除带宽计划
+    var rules []BandwidthRule
+    if schedule != nil {
+        if err := json.Unmarshal([]byte(C.GoString(schedule)), &rules); err != nil {
+            return -1
+        }
+    }
+    if err := downloader.SetSchedule(rules); err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export enqueueDownload
+func enqueueDownload(id C.int, priority C.int) C.int {
+    // 运行中的下载数未达到上限时立即在后台开始下载
+    if err := defaultManager.Enqueue(int(id), int(priority)); err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setDownloadPriority
+func setDownloadPriority(id C.int, priority C.int) C.int {
+    if err := defaultManager.SetPriority(int(id), int(priority)); err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export promoteDownload
+func promoteDownload(id C.int) C.int {
+    if err := defaultManager.Promote(int(id)); err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export dequeueDownload
+func dequeueDownload(id C.int) C.int {
+    if err := defaultManager.Dequeue(int(id)); err != nil {
+        return -1
+    }
+    return 0
+}
+
+//export setMaxActiveDownloads
+func setMaxActiveDownloads(maxActive C.int) C.int {
+    if maxActive < 0 {
+        return -1
+    }
+
+    defaultManager.SetMaxActive(int(maxActive))
+    return 0
+}
+
+//export listQueue
+func listQueue() *C.char {
+    // 返回的字符串需要调用 freeString 释放
+    data, err := json.Marshal(defaultManager.Queue())
+    if err != nil {
+        return nil
+    }
+    return C.CString(string(data))
+}
+
+//export freeString
+func freeString(str *C.char) {
+    C.free(unsafe.Pointer(str))
+}
+
 //export pauseDownload
 func pauseDownload(id C.int) C.int {
-    downloader, exists := downloaders[int(id)]
+    downloader, exists := defaultManager.Get(int(id))
     if !exists {
         return -1
     }
 
-    downloader.PauseDownload()
+    if err := downloader.PauseDownload(); err != nil {
+        return -1
+    }
     return 0
 }
 
 //export resumeDownload
 func resumeDownload(id C.int) C.int {
-    downloader, exists := downloaders[int(id)]
+    downloader, exists := defaultManager.Get(int(id))
     if !exists {
         return -1
     }
 
-    err := downloader.ResumeDownload()
-    if err != nil {
+    // 由队列启动的下载重新排队，在后台恢复，不占用超过上限的名额
+    if defaultManager.ResumeQueued(int(id)) {
+        return 0
+    }
+    return downloadResultCode(downloader.ResumeDownload())
+}
+
+//export getDownloadState
+func getDownloadState(id C.int) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
         return -1
     }
 
+    return C.int(downloader.GetState())
+}
+
+//export cancelDownload
+func cancelDownload(id C.int) C.int {
+    downloader, exists := defaultManager.Get(int(id))
+    if !exists {
+        return -1
+    }
+
+    if err := downloader.CancelDownload(); err != nil {
+        return -1
+    }
     return 0
 }
 
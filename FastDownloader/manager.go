@@ -0,0 +1,200 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "sync"
+)
+
+// connectionLimit 可在运行中调整上限的连接计数器
+type connectionLimit struct {
+    limit  int           // 最大连接数，0 表示不限制
+    active int           // 当前连接数
+    wake   chan struct{} // 有连接释放或上限调整时关闭，唤醒等待者
+}
+
+// Manager 下载管理器：所有下载器共享同一个传输层和全局连接限制，
+// 并负责分配下载器 ID，C 接口通过它线程安全地查找下载器
+type Manager struct {
+    mutex       sync.Mutex
+    clients     map[string]*http.Client     // 按连接设置共享的HTTP客户端
+    downloaders map[int]*FastDownloader
+    nextID      int
+    total       connectionLimit             // 所有下载器的总连接数
+    maxPerHost  int                         // 所有下载器对同一主机的最大连接数，0 表示不限制
+    hosts       map[string]*connectionLimit // 各主机的连接数
+    queue       []*queueItem                // 等待中的下载
+    queueSeq    int64                       // 入队计数，用于同优先级先入先出
+    running     map[int]int                 // 由队列启动、正在运行的下载器 ID 及其优先级
+    paused      map[int]int                 // 由队列启动后被暂停的下载器 ID 及其优先级，恢复时重新排队
+    resumed     map[int]bool                // 暂停后、下载协程退出前就被恢复的下载器 ID
+    maxActive   int                         // 队列同时运行的下载数，0 表示不限制
+    rate        *rateLimiter                // 所有下载器合计的限速
+    hostRates   map[string]*rateLimiter     // 各主机的限速
+}
+
+// defaultManager C 接口使用的下载管理器
+var defaultManager = NewManager()
+
+// NewManager 创建下载管理器
+func NewManager() *Manager {
+    return &Manager{
+        clients:     make(map[string]*http.Client),
+        downloaders: make(map[int]*FastDownloader),
+        hosts:       make(map[string]*connectionLimit),
+        running:     make(map[int]int),
+        paused:      make(map[int]int),
+        resumed:     make(map[int]bool),
+        maxActive:   defaultMaxActive,
+        rate:        newRateLimiter(0),
+        hostRates:   make(map[string]*rateLimiter),
+    }
+}
+
+// Add 使用共享的传输层创建下载器并注册，返回下载器 ID（从 1 开始）
+func (m *Manager) Add(config *DownloadConfig) (int, *FastDownloader) {
+    fd := newDownloader(config)
+    fd.manager = m
+    options := fd.connectionOptions()
+    if client, err := m.clientFor(options); err == nil {
+        fd.client = client
+        fd.clientKey = options.key()
+    }
+
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    m.nextID++
+    m.downloaders[m.nextID] = fd
+    return m.nextID, fd
+}
+
+// clientFor 获取连接设置对应的共享HTTP客户端，没有时创建
+func (m *Manager) clientFor(options connectionOptions) (*http.Client, error) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    key := options.key()
+    if client, ok := m.clients[key]; ok {
+        return client, nil
+    }
+    client, err := newClient(options)
+    if err != nil {
+        return nil, err
+    }
+    m.clients[key] = client
+    return client, nil
+}
+
+// Get 根据 ID 查找下载器
+func (m *Manager) Get(id int) (*FastDownloader, bool) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    fd, ok := m.downloaders[id]
+    return fd, ok
+}
+
+// Remove 注销下载器并移出下载队列，下载中或已暂停的下载器需要先取消
+func (m *Manager) Remove(id int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    fd, ok := m.downloaders[id]
+    if !ok {
+        return fmt.Errorf("找不到下载器: %d", id)
+    }
+    if _, running := m.running[id]; running {
+        return fmt.Errorf("下载器 %d 正在下载，请先取消", id)
+    }
+    if state := fd.GetState(); state == StateRunning || state == StatePaused {
+        return fmt.Errorf("下载器 %d 处于 %s 状态，请先取消", id, state)
+    }
+    if index := m.queuedIndex(id); index >= 0 {
+        m.queue = append(m.queue[:index], m.queue[index+1:]...)
+    }
+    delete(m.paused, id)
+    delete(m.downloaders, id)
+    return nil
+}
+
+// SetLimits 设置所有下载器共享的总连接数和单个主机的连接数，0 表示不限制，
+// 下载过程中调整时立即对新请求生效
+func (m *Manager) SetLimits(maxConnections int, maxPerHost int) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    m.total.limit = maxConnections
+    m.wakeLocked(&m.total)
+    m.maxPerHost = maxPerHost
+    for _, host := range m.hosts {
+        host.limit = maxPerHost
+        m.wakeLocked(host)
+    }
+}
+
+// hostLimit 获取主机的连接计数器，调用方需持有 m.mutex
+func (m *Manager) hostLimit(host string) *connectionLimit {
+    limit, ok := m.hosts[host]
+    if !ok {
+        limit = &connectionLimit{limit: m.maxPerHost}
+        m.hosts[host] = limit
+    }
+    return limit
+}
+
+// wakeLocked 唤醒等待该计数器的协程，调用方需持有 m.mutex
+func (m *Manager) wakeLocked(limit *connectionLimit) {
+    if limit.wake != nil {
+        close(limit.wake)
+        limit.wake = nil
+    }
+}
+
+// acquire 等待总连接数和主机连接数都有空闲名额并各占用一个
+func (m *Manager) acquire(ctx context.Context, host string) error {
+    for {
+        m.mutex.Lock()
+        hostLimit := m.hostLimit(host)
+        var full *connectionLimit
+        if m.total.limit > 0 && m.total.active >= m.total.limit {
+            full = &m.total
+        } else if hostLimit.limit > 0 && hostLimit.active >= hostLimit.limit {
+            full = hostLimit
+        }
+        if full == nil {
+            m.total.active++
+            hostLimit.active++
+            m.mutex.Unlock()
+            return nil
+        }
+        if full.wake == nil {
+            full.wake = make(chan struct{})
+        }
+        wake := full.wake
+        m.mutex.Unlock()
+
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-wake:
+        }
+    }
+}
+
+// release 归还 acquire 占用的名额
+func (m *Manager) release(host string) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    hostLimit := m.hostLimit(host)
+    if m.total.active > 0 {
+        m.total.active--
+    }
+    if hostLimit.active > 0 {
+        hostLimit.active--
+    }
+    m.wakeLocked(&m.total)
+    m.wakeLocked(hostLimit)
+}
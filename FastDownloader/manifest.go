@@ -0,0 +1,358 @@
+package main
+
+import (
+    "encoding/hex"
+    "encoding/json"
+    "fmt"
+    "io"
+    "os"
+    "strings"
+)
+
+// manifestSuffix 生成的块哈希清单文件后缀，与保存路径放在同一目录
+const manifestSuffix = ".manifest.json"
+
+// defaultManifestAlgorithm 生成块哈希清单时默认使用的算法
+const defaultManifestAlgorithm = "sha256"
+
+// ChunkManifest 块哈希清单：按固定大小划分文件，记录每一块的哈希值，用于校验和修复已有文件
+type ChunkManifest struct {
+    Size      int64    // 文件大小
+    Checksum  string   // 完整文件的校验和（"算法:十六进制值"），可为空
+    Algorithm string   // 块哈希算法，与校验和支持的算法相同
+    ChunkSize int64    // 块大小，最后一块可能不足
+    Chunks    []string // 各块的哈希值（十六进制）
+}
+
+// LoadManifest 读取 JSON 格式的块哈希清单
+func LoadManifest(path string) (*ChunkManifest, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("读取块哈希清单失败: %v", err)
+    }
+
+    var manifest ChunkManifest
+    if err := json.Unmarshal(data, &manifest); err != nil {
+        return nil, fmt.Errorf("解析块哈希清单失败: %v", err)
+    }
+    if err := manifest.validate(); err != nil {
+        return nil, err
+    }
+    return &manifest, nil
+}
+
+// validate 检查清单的块数与文件大小是否一致，以及各哈希值的格式
+func (m *ChunkManifest) validate() error {
+    h, err := newChecksumHash(m.Algorithm)
+    if err != nil {
+        return err
+    }
+    if m.Size < 0 || m.ChunkSize <= 0 {
+        return fmt.Errorf("块哈希清单的文件大小或块大小无效")
+    }
+    if count := (m.Size + m.ChunkSize - 1) / m.ChunkSize; int64(len(m.Chunks)) != count {
+        return fmt.Errorf("块哈希清单应有 %d 块，实际 %d 块", count, len(m.Chunks))
+    }
+    for i, value := range m.Chunks {
+        if decoded, err := hex.DecodeString(value); err != nil || len(decoded) != h.Size() {
+            return fmt.Errorf("块哈希清单第 %d 块的哈希值无效: %q", i, value)
+        }
+    }
+    if _, _, err := parseChecksum(m.Checksum); err != nil {
+        return err
+    }
+    return nil
+}
+
+// GenerateManifest 读取文件生成块哈希清单，完整文件的校验和与各块哈希使用同一算法
+func GenerateManifest(path string, algorithm string, chunkSize int64) (*ChunkManifest, error) {
+    if chunkSize <= 0 {
+        return nil, fmt.Errorf("无效的块大小: %d", chunkSize)
+    }
+    whole, err := newChecksumHash(algorithm)
+    if err != nil {
+        return nil, err
+    }
+
+    file, err := os.Open(path)
+    if err != nil {
+        return nil, err
+    }
+    defer file.Close()
+
+    manifest := &ChunkManifest{
+        Algorithm: algorithm,
+        ChunkSize: chunkSize,
+        Chunks:    []string{},
+    }
+    for {
+        chunk, _ := newChecksumHash(algorithm)
+        n, err := io.CopyN(io.MultiWriter(whole, chunk), file, chunkSize)
+        if n > 0 {
+            manifest.Size += n
+            manifest.Chunks = append(manifest.Chunks, hex.EncodeToString(chunk.Sum(nil)))
+        }
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return nil, fmt.Errorf("读取文件失败: %v", err)
+        }
+    }
+    manifest.Checksum = algorithm + ":" + hex.EncodeToString(whole.Sum(nil))
+    return manifest, nil
+}
+
+// Save 将清单以 JSON 格式写入文件，先写临时文件再重命名
+func (m *ChunkManifest) Save(path string) error {
+    data, err := json.MarshalIndent(m, "", "    ")
+    if err != nil {
+        return fmt.Errorf("序列化块哈希清单失败: %v", err)
+    }
+
+    tmpPath := path + ".tmp"
+    if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+        return fmt.Errorf("写入块哈希清单失败: %v", err)
+    }
+    if err := os.Rename(tmpPath, path); err != nil {
+        os.Remove(tmpPath)
+        return fmt.Errorf("写入块哈希清单失败: %v", err)
+    }
+    return nil
+}
+
+// chunkRange 获取第 index 块的范围（含两端）
+func (m *ChunkManifest) chunkRange(index int) (int64, int64) {
+    start := int64(index) * m.ChunkSize
+    end := start + m.ChunkSize - 1
+    if end >= m.Size {
+        end = m.Size - 1
+    }
+    return start, end
+}
+
+// checkChunks 计算文件中指定块的哈希值，返回与清单不一致的块，indexes 为 nil 时检查所有块
+func (m *ChunkManifest) checkChunks(file *os.File, indexes []int) ([]int, error) {
+    if indexes == nil {
+        indexes = make([]int, len(m.Chunks))
+        for i := range indexes {
+            indexes[i] = i
+        }
+    }
+
+    var bad []int
+    for _, index := range indexes {
+        h, err := newChecksumHash(m.Algorithm)
+        if err != nil {
+            return nil, err
+        }
+        start, end := m.chunkRange(index)
+        if _, err := io.Copy(h, io.NewSectionReader(file, start, end-start+1)); err != nil {
+            return nil, fmt.Errorf("读取块 %d 失败: %v", index, err)
+        }
+        if hex.EncodeToString(h.Sum(nil)) != strings.ToLower(m.Chunks[index]) {
+            bad = append(bad, index)
+        }
+    }
+    return bad, nil
+}
+
+// manifest 获取该文件的块哈希清单，没有时返回 nil
+func (ft *fileTask) manifest() *ChunkManifest {
+    if ft.index < len(ft.fd.config.Manifests) {
+        return ft.fd.config.Manifests[ft.index]
+    }
+    return nil
+}
+
+// validateManifests 检查块哈希清单，数量不能多于 URL 数量
+func validateManifests(manifests []*ChunkManifest, urlCount int) error {
+    if len(manifests) > urlCount {
+        return fmt.Errorf("块哈希清单数量多于URL数量")
+    }
+    for i, manifest := range manifests {
+        if manifest == nil {
+            continue
+        }
+        if err := manifest.validate(); err != nil {
+            return fmt.Errorf("第 %d 个文件的块哈希清单: %v", i+1, err)
+        }
+    }
+    return nil
+}
+
+// validateManifestOutput 检查生成块哈希清单的设置，块大小为 0 表示不生成
+func validateManifestOutput(chunkSize int64, algorithm string) error {
+    if chunkSize < 0 {
+        return fmt.Errorf("无效的块哈希清单块大小: %d", chunkSize)
+    }
+    if chunkSize == 0 || algorithm == "" {
+        return nil
+    }
+    _, err := newChecksumHash(algorithm)
+    return err
+}
+
+// writeManifest 文件下载并校验完成后在保存路径旁生成块哈希清单，失败时只发送警告
+func (ft *fileTask) writeManifest() {
+    chunkSize := ft.fd.config.ManifestChunkSize
+    if chunkSize <= 0 {
+        return
+    }
+    algorithm := ft.fd.config.ManifestAlgorithm
+    if algorithm == "" {
+        algorithm = defaultManifestAlgorithm
+    }
+
+    path := ft.savePath + manifestSuffix
+    manifest, err := GenerateManifest(ft.savePath, algorithm, chunkSize)
+    if err == nil {
+        err = manifest.Save(path)
+    }
+    if err != nil {
+        ft.send(Event{
+            Type: EventTypeMsg,
+            Name: "警告",
+        }, map[string]interface{}{
+            "Text": fmt.Sprintf("警告: 生成块哈希清单失败: %v", err),
+        })
+        return
+    }
+
+    ft.send(Event{
+        Type: EventTypeManifest,
+        Name: "块哈希清单",
+    }, map[string]interface{}{
+        "Path":       path,
+        "Size":       manifest.Size,
+        "Checksum":   manifest.Checksum,
+        "ChunkSize":  manifest.ChunkSize,
+        "ChunkCount": len(manifest.Chunks),
+    })
+}
+
+// canRepair 检查能否修复已有文件：文件不存在、大小与清单或远程文件不一致，
+// 或者服务器不支持 Range 时发送警告并返回 false，由调用方重新下载整个文件
+func (ft *fileTask) canRepair(savePath string, manifest *ChunkManifest) bool {
+    var reason string
+    stat, err := os.Stat(savePath)
+    switch {
+    case manifest.Size != ft.totalSize:
+        reason = fmt.Sprintf("块哈希清单的文件大小(%d)与远程文件(%d)不一致", manifest.Size, ft.totalSize)
+    case err != nil:
+        reason = "本地文件不存在"
+    case stat.Size() != manifest.Size:
+        reason = fmt.Sprintf("本地文件大小(%d)与块哈希清单(%d)不一致", stat.Size(), manifest.Size)
+    case ft.singleStream:
+        reason = "服务器不支持 Range 请求"
+    }
+    if reason != "" {
+        ft.send(Event{
+            Type: EventTypeMsg,
+            Name: "警告",
+        }, map[string]interface{}{
+            "Text": fmt.Sprintf("警告: %s，无法修复，重新下载整个文件", reason),
+        })
+        return false
+    }
+    return true
+}
+
+// openForRepair 打开已有文件并按清单校验各块，块表与清单一一对应，只有不一致的块需要重新下载
+func (ft *fileTask) openForRepair(savePath string, manifest *ChunkManifest) (*os.File, error) {
+    file, err := os.OpenFile(savePath, os.O_RDWR, 0644)
+    if err != nil {
+        ft.send(Event{
+            Type: EventTypeMsg,
+            Name: "错误",
+        }, map[string]interface{}{
+            "Text": fmt.Sprintf("打开文件失败: %v", err),
+        })
+        return nil, fmt.Errorf("打开文件失败: %v", err)
+    }
+    bad, err := manifest.checkChunks(file, nil)
+    if err != nil {
+        file.Close()
+        return nil, err
+    }
+
+    // 一致的块直接标记为已完成
+    chunks := make([]*DownloadChunk, len(manifest.Chunks))
+    var downloaded, badBytes int64
+    for i := range chunks {
+        start, end := manifest.chunkRange(i)
+        chunks[i] = &DownloadChunk{
+            StartOffset: start,
+            EndOffset:   end,
+            Downloaded:  end - start + 1,
+            Done:        true,
+        }
+    }
+    for _, index := range bad {
+        chunk := chunks[index]
+        chunk.Downloaded = 0
+        chunk.Done = false
+        badBytes += chunk.EndOffset - chunk.StartOffset + 1
+    }
+    for _, chunk := range chunks {
+        downloaded += chunk.Downloaded
+    }
+
+    repairing := append([]int{}, bad...)
+    ft.mutex.Lock()
+    ft.chunks = chunks
+    ft.downloaded = downloaded
+    ft.repairing = repairing
+    ft.mutex.Unlock()
+
+    ft.send(Event{
+        Type: EventTypeRepair,
+        Name: "修复",
+    }, map[string]interface{}{
+        "Stage":      "checked",
+        "Chunks":     repairing,
+        "ChunkCount": len(manifest.Chunks),
+        "Bytes":      badBytes,
+    })
+    return file, nil
+}
+
+// confirmRepair 修复完成后重新校验重新下载的块，仍不一致时说明远程文件与清单不符
+func (ft *fileTask) confirmRepair(file *os.File, manifest *ChunkManifest) error {
+    ft.mutex.Lock()
+    repaired := ft.repairing
+    ft.mutex.Unlock()
+    if repaired == nil {
+        return nil
+    }
+
+    bad, err := manifest.checkChunks(file, repaired)
+    if err != nil {
+        return err
+    }
+    if len(bad) > 0 {
+        ft.send(Event{
+            Type: EventTypeMsg,
+            Name: "错误",
+        }, map[string]interface{}{
+            "Text": fmt.Sprintf("块 %v 重新下载后仍与块哈希清单不一致", bad),
+        })
+        return fmt.Errorf("%w: 块 %v 重新下载后仍与块哈希清单不一致", ErrChecksumMismatch, bad)
+    }
+
+    var bytes int64
+    for _, index := range repaired {
+        start, end := manifest.chunkRange(index)
+        bytes += end - start + 1
+    }
+    ft.send(Event{
+        Type: EventTypeRepair,
+        Name: "修复",
+    }, map[string]interface{}{
+        "Stage":      "repaired",
+        "Chunks":     repaired,
+        "ChunkCount": len(manifest.Chunks),
+        "Bytes":      bytes,
+    })
+    return nil
+}
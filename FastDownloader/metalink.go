@@ -0,0 +1,170 @@
+package main
+
+import (
+    "encoding/xml"
+    "fmt"
+    "net/url"
+    "os"
+    "path/filepath"
+    "sort"
+    "strings"
+)
+
+// metalinkDocument Metalink 4（RFC 5854）文档中用到的部分
+type metalinkDocument struct {
+    XMLName xml.Name       `xml:"metalink"`
+    Files   []metalinkFile `xml:"file"`
+}
+
+// metalinkFile Metalink 中的一个文件
+type metalinkFile struct {
+    Name   string          `xml:"name,attr"`
+    Size   int64           `xml:"size"`
+    Hashes []metalinkHash  `xml:"hash"`
+    Pieces *metalinkPieces `xml:"pieces"`
+    URLs   []metalinkURL   `xml:"url"`
+}
+
+// metalinkHash 文件的哈希值，type 为 IANA 哈希算法名（如 sha-256）
+type metalinkHash struct {
+    Type  string `xml:"type,attr"`
+    Value string `xml:",chardata"`
+}
+
+// metalinkPieces 按固定长度划分的各块哈希
+type metalinkPieces struct {
+    Length int64    `xml:"length,attr"`
+    Type   string   `xml:"type,attr"`
+    Hashes []string `xml:"hash"`
+}
+
+// metalinkURL 文件的下载地址，priority 越小越优先，未设置时排在最后
+type metalinkURL struct {
+    Priority int    `xml:"priority,attr"`
+    Value    string `xml:",chardata"`
+}
+
+// LoadMetalink 读取 .meta4 文件并转换为下载配置：每个文件优先级最高的地址作为主地址，
+// 其余地址作为镜像，保存到 saveDir 下的同名文件（名称中的子目录会被创建），
+// 文件大小、最强的哈希和块哈希分别用于检查大小、校验完整文件以及作为修复模式使用的块哈希清单
+func LoadMetalink(path string, saveDir string) (*DownloadConfig, error) {
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("读取 Metalink 文件失败: %v", err)
+    }
+    return ParseMetalink(data, saveDir)
+}
+
+// ParseMetalink 将 Metalink 文档转换为下载配置，规则与 LoadMetalink 相同
+func ParseMetalink(data []byte, saveDir string) (*DownloadConfig, error) {
+    var doc metalinkDocument
+    if err := xml.Unmarshal(data, &doc); err != nil {
+        return nil, fmt.Errorf("解析 Metalink 文件失败: %v", err)
+    }
+    if len(doc.Files) == 0 {
+        return nil, fmt.Errorf("Metalink 文件中没有文件")
+    }
+
+    config := &DownloadConfig{}
+    for i, file := range doc.Files {
+        savePath, err := metalinkSavePath(saveDir, file.Name)
+        if err != nil {
+            return nil, fmt.Errorf("Metalink 第 %d 个文件: %v", i+1, err)
+        }
+        urls := file.sortedURLs()
+        if len(urls) == 0 {
+            return nil, fmt.Errorf("Metalink 文件 %s 没有可用的 HTTP 地址", file.Name)
+        }
+        if err := os.MkdirAll(filepath.Dir(savePath), 0755); err != nil {
+            return nil, fmt.Errorf("创建目录失败: %v", err)
+        }
+
+        config.URLs = append(config.URLs, urls[0])
+        config.SavePaths = append(config.SavePaths, savePath)
+        config.Mirrors = append(config.Mirrors, urls[1:])
+        config.ExpectedSizes = append(config.ExpectedSizes, file.Size)
+        config.Checksums = append(config.Checksums, file.checksum())
+        config.Manifests = append(config.Manifests, file.manifest())
+    }
+    return config, nil
+}
+
+// metalinkSavePath 根据文件名得到保存路径，文件名不能是绝对路径或跳出保存目录
+func metalinkSavePath(saveDir string, name string) (string, error) {
+    if name == "" {
+        return "", fmt.Errorf("缺少文件名")
+    }
+    cleaned := filepath.Clean(filepath.FromSlash(name))
+    if filepath.IsAbs(cleaned) || strings.HasPrefix(name, "/") || cleaned == ".." ||
+        strings.HasPrefix(cleaned, ".."+string(filepath.Separator)) {
+        return "", fmt.Errorf("不安全的文件名: %q", name)
+    }
+    return filepath.Join(saveDir, cleaned), nil
+}
+
+// sortedURLs 按优先级排列的 HTTP(S) 地址
+func (file *metalinkFile) sortedURLs() []string {
+    candidates := make([]metalinkURL, 0, len(file.URLs))
+    for _, u := range file.URLs {
+        u.Value = strings.TrimSpace(u.Value)
+        parsed, err := url.Parse(u.Value)
+        if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+            continue
+        }
+        candidates = append(candidates, u)
+    }
+
+    sort.SliceStable(candidates, func(i, j int) bool {
+        pi, pj := candidates[i].Priority, candidates[j].Priority
+        if pi <= 0 || pj <= 0 {
+            return pi > 0 && pj <= 0
+        }
+        return pi < pj
+    })
+
+    urls := make([]string, 0, len(candidates))
+    for _, u := range candidates {
+        urls = append(urls, u.Value)
+    }
+    return urls
+}
+
+// checksum 选择最强的完整文件哈希，返回 "算法:十六进制值"，没有支持的算法时返回空字符串
+func (file *metalinkFile) checksum() string {
+    digests := make(map[string]string)
+    for _, h := range file.Hashes {
+        algorithm := digestAlgorithm(h.Type)
+        if algorithm == "" {
+            continue
+        }
+        if value := strings.ToLower(strings.TrimSpace(h.Value)); decodeDigest(algorithm, value) == value {
+            digests[algorithm] = value
+        }
+    }
+    return preferredDigest(digests)
+}
+
+// manifest 将块哈希转换为块哈希清单，缺少文件大小、算法不支持或块数不符时返回 nil
+func (file *metalinkFile) manifest() *ChunkManifest {
+    if file.Pieces == nil || file.Size <= 0 {
+        return nil
+    }
+    algorithm := digestAlgorithm(file.Pieces.Type)
+    if algorithm == "" {
+        return nil
+    }
+
+    manifest := &ChunkManifest{
+        Size:      file.Size,
+        Checksum:  file.checksum(),
+        Algorithm: algorithm,
+        ChunkSize: file.Pieces.Length,
+    }
+    for _, h := range file.Pieces.Hashes {
+        manifest.Chunks = append(manifest.Chunks, strings.ToLower(strings.TrimSpace(h)))
+    }
+    if manifest.validate() != nil {
+        return nil
+    }
+    return manifest
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "net/http"
+    "time"
+)
+
+// maxMirrorFailures 镜像连续失败多少次后停用
+const maxMirrorFailures = 3
+
+// 镜像评分参数
+const (
+    mirrorEWMAWeight     = 0.3              // 新样本在吞吐量、延迟移动平均中的权重
+    mirrorSampleMinBytes = 64 * 1024        // 少于该字节数的传输不参与吞吐量统计
+    mirrorReferenceSize  = 4 * 1024 * 1024  // 评分时假定的块大小，用于折算延迟
+    mirrorSlowRatio      = 0.25             // 得分低于最快镜像的该比例时降级，不再分配新块
+    mirrorRetestInterval = 30 * time.Second // 降级的镜像空闲超过该时间后重新分配一个块测速
+)
+
+// errNoMirror 没有可用的镜像
+var errNoMirror = errors.New("没有可用的镜像")
+
+// mirror 同一文件的一个下载地址
+type mirror struct {
+    URL        string
+    Info       *RemoteFileInfo // 该镜像返回的文件信息，If-Range 使用各自的校验值
+    Failures   int             // 连续失败次数
+    Disabled   bool            // 已停用
+    Active     int             // 正在使用该镜像的连接数
+    Requests   int             // 已发起的请求数
+    Errors     int             // 失败的请求数
+    Bytes      int64           // 已下载的字节数
+    Throughput float64         // 单连接吞吐量（字节/秒）的移动平均，0 表示尚未测速
+    Latency    time.Duration   // 从发出请求到收到响应头的时间的移动平均
+    lastUsed   time.Time       // 最近一次分配块的时间
+}
+
+// MirrorStat 镜像统计信息，用于进度事件
+type MirrorStat struct {
+    URL        string
+    Active     int     // 当前连接数
+    Requests   int     // 已发起的请求数
+    Errors     int     // 失败的请求数
+    Downloaded int64   // 已下载的字节数
+    Throughput float64 // 单连接吞吐量（字节/秒）
+    Latency    int64   // 平均响应延迟（毫秒）
+    Score      float64 // 评分，-1 表示尚未测速
+    Demoted    bool    // 速度过慢已降级
+    Disabled   bool    // 已停用
+}
+
+// score 镜像评分：按参考块大小估算的有效吞吐量（含响应延迟），再乘以请求成功率，
+// 尚未测速时返回 -1
+func (m *mirror) score() float64 {
+    if m.Throughput <= 0 {
+        return -1
+    }
+
+    successRate := 1.0
+    if m.Requests > 0 {
+        successRate -= float64(m.Errors) / float64(m.Requests)
+    }
+    if successRate < 0 {
+        successRate = 0
+    }
+
+    seconds := m.Latency.Seconds() + mirrorReferenceSize/m.Throughput
+    return successRate * mirrorReferenceSize / seconds
+}
+
+// ewma 计算移动平均，old 为 0 时直接使用新样本
+func ewma(old float64, sample float64) float64 {
+    if old == 0 {
+        return sample
+    }
+    return old + mirrorEWMAWeight*(sample-old)
+}
+
+// mirrorURLs 获取文件的所有下载地址，主地址在前
+func (ft *fileTask) mirrorURLs(primary string) []string {
+    urls := []string{primary}
+    if ft.index < len(ft.fd.config.Mirrors) {
+        for _, url := range ft.fd.config.Mirrors[ft.index] {
+            if url != "" && url != primary {
+                urls = append(urls, url)
+            }
+        }
+    }
+    return urls
+}
+
+// probeMirrors 获取主地址和所有镜像的文件信息，丢弃无法访问、大小不一致或不支持分块的镜像，
+// 返回作为基准的文件信息
+func (ft *fileTask) probeMirrors(ctx context.Context, primary string) (*RemoteFileInfo, error) {
+    urls := ft.mirrorURLs(primary)
+
+    var mirrors []*mirror
+    var firstErr error
+    for _, url := range urls {
+        info, err := ft.getFileSize(ctx, url)
+        if err != nil {
+            if ctx.Err() != nil || len(urls) == 1 {
+                return nil, err
+            }
+            if firstErr == nil {
+                firstErr = err
+            }
+            ft.notifyMirrorDropped(url, fmt.Sprintf("获取文件信息失败: %v", err))
+            continue
+        }
+        mirrors = append(mirrors, &mirror{URL: url, Info: info})
+    }
+    if len(mirrors) == 0 {
+        return nil, firstErr
+    }
+
+    // 以第一个大小已知且支持分块的镜像为基准，没有时只使用第一个可用地址
+    reference := mirrors[0]
+    for _, m := range mirrors {
+        if m.Info.Size >= 0 && m.Info.AcceptRanges {
+            reference = m
+            break
+        }
+    }
+
+    kept := []*mirror{reference}
+    for _, m := range mirrors {
+        if m == reference {
+            continue
+        }
+        switch {
+        case reference.Info.Size < 0 || !reference.Info.AcceptRanges || ft.singleStream:
+            ft.notifyMirrorDropped(m.URL, "无法分块下载，只使用单个地址")
+        case m.Info.Size != reference.Info.Size:
+            ft.notifyMirrorDropped(m.URL, fmt.Sprintf("文件大小(%d)与基准(%d)不一致", m.Info.Size, reference.Info.Size))
+        case !m.Info.AcceptRanges:
+            ft.notifyMirrorDropped(m.URL, "不支持 Range 请求")
+        default:
+            kept = append(kept, m)
+        }
+    }
+
+    ft.mutex.Lock()
+    ft.mirrors = kept
+    ft.mutex.Unlock()
+
+    return reference.Info, nil
+}
+
+// bestMirrorScore 可用镜像中的最高评分，都未测速时返回 0，调用方需持有 ft.mutex
+func (ft *fileTask) bestMirrorScore() float64 {
+    best := 0.0
+    for _, m := range ft.mirrors {
+        if !m.Disabled && m.score() > best {
+            best = m.score()
+        }
+    }
+    return best
+}
+
+// isDemoted 判断镜像是否因速度过慢被降级，调用方需持有 ft.mutex
+func (m *mirror) isDemoted(best float64) bool {
+    score := m.score()
+    return score >= 0 && score < best*mirrorSlowRatio
+}
+
+// pickMirror 选择下一个块使用的镜像并占用一个连接，使用完后需调用 releaseMirror。
+// 尚未测速的镜像优先分配一个连接用于测速，其余按评分除以当前连接数选择，
+// 使连接数与镜像速度大致成正比；降级的镜像空闲一段时间后才会再分配一个块重新测速
+func (ft *fileTask) pickMirror() *mirror {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    best := ft.bestMirrorScore()
+    var chosen *mirror
+    chosenValue := 0.0
+    for _, m := range ft.mirrors {
+        if m.Disabled {
+            continue
+        }
+
+        score := m.score()
+        if score < 0 {
+            if m.Active == 0 {
+                chosen = m
+                break
+            }
+            // 测速尚未完成，暂按最快镜像计算
+            score = best
+            if score == 0 {
+                score = 1
+            }
+        } else if m.isDemoted(best) {
+            if m.Active == 0 && time.Since(m.lastUsed) >= mirrorRetestInterval {
+                chosen = m
+                break
+            }
+            continue
+        }
+
+        value := score / float64(m.Active+1)
+        if chosen == nil || value > chosenValue {
+            chosen = m
+            chosenValue = value
+        }
+    }
+    if chosen == nil {
+        return nil
+    }
+
+    chosen.Active++
+    chosen.Requests++
+    chosen.lastUsed = time.Now()
+    return chosen
+}
+
+// releaseMirror 释放 pickMirror 占用的连接，并记录请求是否失败
+func (ft *fileTask) releaseMirror(m *mirror, err error) {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    if m.Active > 0 {
+        m.Active--
+    }
+    // 暂停或取消导致的错误不计入镜像的失败次数
+    if err != nil && !errors.Is(err, context.Canceled) {
+        m.Errors++
+    }
+}
+
+// recordMirrorLatency 记录一次请求的响应延迟
+func (ft *fileTask) recordMirrorLatency(m *mirror, latency time.Duration) {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    m.Latency = time.Duration(ewma(float64(m.Latency), float64(latency)))
+}
+
+// recordMirrorTransfer 记录一次传输的字节数和耗时，用于计算吞吐量
+func (ft *fileTask) recordMirrorTransfer(m *mirror, bytes int64, elapsed time.Duration) {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    m.Bytes += bytes
+    if bytes < mirrorSampleMinBytes || elapsed <= 0 {
+        return
+    }
+    m.Throughput = ewma(m.Throughput, float64(bytes)/elapsed.Seconds())
+}
+
+// mirrorSnapshot 获取各镜像统计信息的副本，用于进度事件
+func (ft *fileTask) mirrorSnapshot() []MirrorStat {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    best := ft.bestMirrorScore()
+    stats := make([]MirrorStat, 0, len(ft.mirrors))
+    for _, m := range ft.mirrors {
+        stats = append(stats, MirrorStat{
+            URL:        m.URL,
+            Active:     m.Active,
+            Requests:   m.Requests,
+            Errors:     m.Errors,
+            Downloaded: m.Bytes,
+            Throughput: m.Throughput,
+            Latency:    m.Latency.Milliseconds(),
+            Score:      m.score(),
+            Demoted:    !m.Disabled && m.isDemoted(best),
+            Disabled:   m.Disabled,
+        })
+    }
+    return stats
+}
+
+// enabledMirrorCount 可用镜像数量，调用方需持有 ft.mutex
+func (ft *fileTask) enabledMirrorCount() int {
+    count := 0
+    for _, m := range ft.mirrors {
+        if !m.Disabled {
+            count++
+        }
+    }
+    return count
+}
+
+// isMirrorFatal 判断错误是否说明该镜像本身不可用（而非临时错误）
+func isMirrorFatal(err error) bool {
+    if errors.Is(err, errRangeNotSupported) || errors.Is(err, errResourceChanged) || errors.Is(err, errInvalidContentRange) {
+        return true
+    }
+    if isCertificateError(err) {
+        return true
+    }
+
+    var statusErr *httpStatusError
+    if errors.As(err, &statusErr) {
+        return statusErr.StatusCode >= 400 && statusErr.StatusCode < 500 &&
+            statusErr.StatusCode != http.StatusRequestTimeout &&
+            statusErr.StatusCode != http.StatusTooManyRequests
+    }
+    return false
+}
+
+// dropMirror 停用镜像，最后一个可用镜像不会被停用，此时返回 false
+func (ft *fileTask) dropMirror(m *mirror, err error) bool {
+    ft.mutex.Lock()
+    if m.Disabled {
+        ft.mutex.Unlock()
+        return true
+    }
+    if ft.enabledMirrorCount() <= 1 {
+        ft.mutex.Unlock()
+        return false
+    }
+    m.Disabled = true
+    ft.mutex.Unlock()
+
+    ft.notifyMirrorDropped(m.URL, err.Error())
+    return true
+}
+
+// mirrorFailed 记录镜像的一次失败，连续失败过多时停用
+func (ft *fileTask) mirrorFailed(m *mirror, err error) {
+    ft.mutex.Lock()
+    m.Failures++
+    failures := m.Failures
+    ft.mutex.Unlock()
+
+    if failures >= maxMirrorFailures {
+        ft.dropMirror(m, fmt.Errorf("连续失败 %d 次: %v", failures, err))
+    }
+}
+
+// mirrorSucceeded 记录镜像成功完成一个块
+func (ft *fileTask) mirrorSucceeded(m *mirror) {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    m.Failures = 0
+}
+
+// notifyMirrorDropped 发送镜像被停用的事件
+func (ft *fileTask) notifyMirrorDropped(url string, reason string) {
+    ft.send(Event{
+        Type: EventTypeMirrorDropped,
+        Name: "停用镜像",
+    }, map[string]interface{}{
+        "URL":    url,
+        "Reason": reason,
+    })
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+    "bytes"
+    "crypto/aes"
+    "crypto/cipher"
+    "crypto/des"
+    "crypto/pbkdf2"
+    "crypto/sha1"
+    "crypto/sha256"
+    "crypto/sha512"
+    "crypto/x509"
+    "crypto/x509/pkix"
+    "encoding/asn1"
+    "errors"
+    "fmt"
+    "hash"
+)
+
+// PKCS#5 v2.0（RFC 8018）中用到的算法标识
+var (
+    oidPBES2        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+    oidPBKDF2       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+    oidHMACWithSHA1 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+    oidAES128CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+    oidAES192CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+    oidAES256CBC    = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+    oidDESEDE3CBC   = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// pbkdf2PRFs PBKDF2 支持的伪随机函数
+var pbkdf2PRFs = map[string]func() hash.Hash{
+    oidHMACWithSHA1.String():                                 sha1.New,
+    asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 8}.String():  sha256.New224,
+    asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}.String():  sha256.New,
+    asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}.String(): sha512.New384,
+    asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}.String(): sha512.New,
+}
+
+// errPKCS8Password 解密后的数据无效，通常是密码错误
+var errPKCS8Password = errors.New("密码错误或私钥已损坏")
+
+// encryptedPrivateKeyInfo PKCS#8 加密私钥（RFC 5958）
+type encryptedPrivateKeyInfo struct {
+    Algorithm     pkix.AlgorithmIdentifier
+    EncryptedData []byte
+}
+
+// pbes2Params PBES2 的参数：密钥派生函数和加密算法
+type pbes2Params struct {
+    KeyDerivationFunc pkix.AlgorithmIdentifier
+    EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params PBKDF2 的参数，未指定伪随机函数时为 HMAC-SHA1
+type pbkdf2Params struct {
+    Salt           []byte
+    IterationCount int
+    KeyLength      int                      `asn1:"optional"`
+    PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// decryptPKCS8 解密 PKCS#8 加密私钥（"ENCRYPTED PRIVATE KEY"），返回未加密的 PKCS#8 私钥（DER）。
+// 支持 PBES2：PBKDF2（HMAC-SHA1/SHA-224/SHA-256/SHA-384/SHA-512）配合 AES-CBC 或 3DES-CBC，
+// 即 openssl genpkey、openssl pkcs8 的输出格式
+func decryptPKCS8(der []byte, password string) ([]byte, error) {
+    var info encryptedPrivateKeyInfo
+    if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) > 0 {
+        return nil, fmt.Errorf("无法解析 PKCS#8 加密私钥")
+    }
+    if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+        return nil, fmt.Errorf("不支持的私钥加密方式: %s，仅支持 PBES2", info.Algorithm.Algorithm)
+    }
+
+    var params pbes2Params
+    if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params); err != nil {
+        return nil, fmt.Errorf("无法解析 PBES2 参数: %v", err)
+    }
+    if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+        return nil, fmt.Errorf("不支持的密钥派生函数: %s，仅支持 PBKDF2", params.KeyDerivationFunc.Algorithm)
+    }
+    var kdf pbkdf2Params
+    if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+        return nil, fmt.Errorf("无法解析 PBKDF2 参数: %v", err)
+    }
+    prf := oidHMACWithSHA1
+    if len(kdf.PRF.Algorithm) > 0 {
+        prf = kdf.PRF.Algorithm
+    }
+    newHash, ok := pbkdf2PRFs[prf.String()]
+    if !ok {
+        return nil, fmt.Errorf("不支持的 PBKDF2 伪随机函数: %s", prf)
+    }
+
+    var keyLength int
+    var newCipher func([]byte) (cipher.Block, error)
+    switch scheme := params.EncryptionScheme.Algorithm; {
+    case scheme.Equal(oidAES128CBC):
+        keyLength, newCipher = 16, aes.NewCipher
+    case scheme.Equal(oidAES192CBC):
+        keyLength, newCipher = 24, aes.NewCipher
+    case scheme.Equal(oidAES256CBC):
+        keyLength, newCipher = 32, aes.NewCipher
+    case scheme.Equal(oidDESEDE3CBC):
+        keyLength, newCipher = 24, des.NewTripleDESCipher
+    default:
+        return nil, fmt.Errorf("不支持的私钥加密算法: %s", scheme)
+    }
+    if kdf.KeyLength != 0 && kdf.KeyLength != keyLength {
+        return nil, fmt.Errorf("PBKDF2 密钥长度 %d 与加密算法不符", kdf.KeyLength)
+    }
+    var iv []byte
+    if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+        return nil, fmt.Errorf("无法解析私钥加密的初始向量: %v", err)
+    }
+
+    key, err := pbkdf2.Key(newHash, password, kdf.Salt, kdf.IterationCount, keyLength)
+    if err != nil {
+        return nil, fmt.Errorf("派生私钥解密密钥失败: %v", err)
+    }
+    block, err := newCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    data := info.EncryptedData
+    if len(iv) != block.BlockSize() || len(data) == 0 || len(data)%block.BlockSize() != 0 {
+        return nil, fmt.Errorf("PKCS#8 加密私钥的数据长度无效")
+    }
+    plain := make([]byte, len(data))
+    cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, data)
+
+    // 去除 PKCS#7 填充，填充或解密结果无效说明密码错误
+    padding := int(plain[len(plain)-1])
+    if padding == 0 || padding > block.BlockSize() ||
+        !bytes.Equal(plain[len(plain)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+        return nil, errPKCS8Password
+    }
+    plain = plain[:len(plain)-padding]
+    if _, err := x509.ParsePKCS8PrivateKey(plain); err != nil {
+        return nil, errPKCS8Password
+    }
+    return plain, nil
+}
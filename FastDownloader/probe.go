@@ -0,0 +1,231 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "io"
+    "net/http"
+    "os"
+    "sync/atomic"
+    "time"
+)
+
+// getFileSize 获取远程文件信息。HEAD 被拒绝或没有 Content-Length 时改用
+// Range: bytes=0-0 的 GET 请求探测，仍无法确定大小时 Size 为 -1。
+// 响应头中服务器提供的摘要一并收集，配置了校验文件扩展名时还会获取主地址旁边的校验文件
+func (ft *fileTask) getFileSize(ctx context.Context, url string) (*RemoteFileInfo, error) {
+    info, err := ft.fd.headFileInfo(ctx, url)
+    if err != nil {
+        if ctx.Err() != nil {
+            return nil, err
+        }
+
+        ft.send(Event{
+            Type: EventTypeMsg,
+            Name: "警告",
+        }, map[string]interface{}{
+            "Text": fmt.Sprintf("警告: HEAD 请求失败(%v)，改用 GET 请求探测文件信息", err),
+        })
+        info, err = ft.probeFileInfo(ctx, url)
+        if err != nil {
+            return nil, err
+        }
+    }
+
+    if extension := ft.fd.config.ChecksumSidecar; extension != "" && url == ft.url {
+        ft.loadSidecarChecksum(ctx, url, extension)
+    }
+    return info, nil
+}
+
+// loadSidecarChecksum 获取校验文件中的校验和，失败时只发送警告，不影响下载
+func (ft *fileTask) loadSidecarChecksum(ctx context.Context, url string, extension string) {
+    spec, err := ft.fd.fetchSidecarChecksum(ctx, url, extension)
+    if err != nil {
+        if ctx.Err() == nil {
+            ft.send(Event{
+                Type: EventTypeMsg,
+                Name: "警告",
+            }, map[string]interface{}{
+                "Text": fmt.Sprintf("警告: 获取校验文件失败: %v", err),
+            })
+        }
+        return
+    }
+
+    ft.mutex.Lock()
+    ft.sidecarChecksum = spec
+    ft.mutex.Unlock()
+}
+
+// probeFileInfo 通过只请求第一个字节的 GET 请求获取文件信息
+func (ft *fileTask) probeFileInfo(ctx context.Context, url string) (*RemoteFileInfo, error) {
+    req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+    if err != nil {
+        return nil, err
+    }
+    req.Header.Set("Range", "bytes=0-0")
+
+    resp, err := ft.fd.client.Do(req)
+    if err != nil {
+        return nil, err
+    }
+    // 服务器忽略 Range 时响应体是完整文件，不读取直接关闭
+    defer resp.Body.Close()
+
+    info := &RemoteFileInfo{
+        Size:         -1,
+        ETag:         resp.Header.Get("ETag"),
+        LastModified: resp.Header.Get("Last-Modified"),
+        Digests:      parseDigests(resp.Header, resp.StatusCode == http.StatusPartialContent),
+    }
+
+    switch resp.StatusCode {
+    case http.StatusPartialContent:
+        _, _, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+        if err != nil {
+            return nil, err
+        }
+        info.Size = total
+        info.AcceptRanges = true
+    case http.StatusOK:
+        if resp.ContentLength >= 0 {
+            info.Size = resp.ContentLength
+        }
+    default:
+        return nil, fmt.Errorf("HTTP错误: %d", resp.StatusCode)
+    }
+
+    return info, nil
+}
+
+// downloadStream 大小未知时使用单连接顺序下载，失败时按重试策略从头重新下载
+func (ft *fileTask) downloadStream(ctx context.Context, url string, savePath string) error {
+    // 无法分块也就无法断点续传
+    removeResumeState(savePath)
+
+    file, err := ft.createTargetFile(savePath)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+    ft.partialFile = true
+
+    ft.startTime = time.Now()
+    ft.startDownloaded = 0
+    ft.notifyProgress(-1, 0)
+
+    maxRetries := ft.fd.maxRetries()
+    for attempt := 1; ; attempt++ {
+        err = ft.streamOnce(ctx, file, url)
+        if err == nil {
+            break
+        }
+        if ctx.Err() != nil {
+            return err
+        }
+        if !isRetryable(err) || attempt > maxRetries {
+            ft.send(Event{
+                Type: EventTypeMsg,
+                Name: "错误",
+            }, map[string]interface{}{
+                "Text": fmt.Sprintf("流式下载失败: %v\n", err),
+            })
+            return err
+        }
+
+        delay := ft.fd.retryDelay(attempt)
+        ft.send(Event{
+            Type: EventTypeRetry,
+            Name: "重试块",
+        }, map[string]interface{}{
+            "Chunk":      0,
+            "Attempt":    attempt,
+            "MaxRetries": maxRetries,
+            "Offset":     0,
+            "Delay":      delay.Milliseconds(),
+            "Error":      err.Error(),
+        })
+
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(delay):
+        }
+
+        // 从头重新下载
+        if err := file.Truncate(0); err != nil {
+            return fmt.Errorf("设置文件大小失败: %v", err)
+        }
+        atomic.StoreInt64(&ft.downloaded, 0)
+        ft.notifyProgress(-1, 0)
+    }
+
+    // 下载完成后文件大小已知
+    ft.mutex.Lock()
+    ft.totalSize = atomic.LoadInt64(&ft.downloaded)
+    ft.mutex.Unlock()
+    ft.notifyProgress(ft.totalSize, ft.totalSize)
+    return nil
+}
+
+// streamOnce 发起一次完整的GET请求并顺序写入文件
+func (ft *fileTask) streamOnce(ctx context.Context, file *os.File, url string) error {
+    req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+    if err != nil {
+        return fmt.Errorf("创建请求失败: %w", err)
+    }
+
+    host := hostOf(url)
+    if err := ft.fd.acquireHost(ctx, host); err != nil {
+        return err
+    }
+    defer ft.fd.releaseHost(host)
+
+    if err := ft.fd.acquireConnection(ctx, host); err != nil {
+        return err
+    }
+    defer ft.fd.releaseConnection(host)
+
+    resp, err := ft.fd.client.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+
+    if resp.StatusCode != http.StatusOK {
+        return &httpStatusError{
+            StatusCode: resp.StatusCode,
+            RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+        }
+    }
+
+    buffer := make([]byte, 64*1024) // 64KB缓冲区
+    var offset int64
+    for {
+        n, err := resp.Body.Read(buffer)
+        if n > 0 {
+            if rateErr := ft.fd.waitRate(ctx, host, n); rateErr != nil {
+                return rateErr
+            }
+            if _, writeErr := file.WriteAt(buffer[:n], offset); writeErr != nil {
+                return writeErr
+            }
+            offset += int64(n)
+            ft.notifyProgress(-1, atomic.AddInt64(&ft.downloaded, int64(n)))
+        }
+
+        if err == io.EOF {
+            break
+        }
+        if err != nil {
+            return err
+        }
+    }
+
+    // 有 Content-Length 时检查响应是否完整
+    if resp.ContentLength >= 0 && offset < resp.ContentLength {
+        return errShortRead
+    }
+    return nil
+}
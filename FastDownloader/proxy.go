@@ -0,0 +1,124 @@
+package main
+
+import (
+    "fmt"
+    "net"
+    "net/http"
+    "net/url"
+    "strings"
+)
+
+// proxyDirect ProxyOptions.URL 为此值时不使用代理，也不读取环境变量
+const proxyDirect = "direct"
+
+// ProxyOptions 代理设置，零值表示按环境变量 HTTP_PROXY、HTTPS_PROXY 和 NO_PROXY 使用代理
+type ProxyOptions struct {
+    URL     string   // 代理地址：http://、https://、socks5:// 或 socks5h://，可带 "用户名:密码@"；为空时使用环境变量，"direct" 表示不使用代理
+    NoProxy []string // 不使用代理的主机，格式与 NO_PROXY 相同：主机名、".域名"、IP、CIDR 或 "*"，可带端口
+}
+
+// parseProxyURL 解析并检查代理地址
+func parseProxyURL(rawURL string) (*url.URL, error) {
+    proxyURL, err := url.Parse(rawURL)
+    if err != nil {
+        return nil, fmt.Errorf("无效的代理地址: %v", err)
+    }
+    switch proxyURL.Scheme {
+    case "http", "https", "socks5", "socks5h":
+    default:
+        return nil, fmt.Errorf("不支持的代理类型: %q，应为 http、https、socks5 或 socks5h", proxyURL.Scheme)
+    }
+    if proxyURL.Hostname() == "" {
+        return nil, fmt.Errorf("代理地址缺少主机名")
+    }
+    return proxyURL, nil
+}
+
+// bypassProxy 判断请求的地址是否在不使用代理的主机列表中：
+// ".example.com" 和 "example.com" 都匹配 example.com 及其子域名，带端口的条目只匹配该端口
+func bypassProxy(target *url.URL, noProxy []string) bool {
+    host := strings.ToLower(target.Hostname())
+    port := target.Port()
+    if port == "" {
+        port = "80"
+        if target.Scheme == "https" {
+            port = "443"
+        }
+    }
+    ip := net.ParseIP(host)
+
+    for _, entry := range noProxy {
+        entry = strings.ToLower(strings.TrimSpace(entry))
+        if entry == "" {
+            continue
+        }
+        if entry == "*" {
+            return true
+        }
+        if _, network, err := net.ParseCIDR(entry); err == nil {
+            if ip != nil && network.Contains(ip) {
+                return true
+            }
+            continue
+        }
+
+        entryHost, entryPort, err := net.SplitHostPort(entry)
+        if err != nil {
+            entryHost, entryPort = strings.Trim(entry, "[]"), ""
+        }
+        if entryPort != "" && entryPort != port {
+            continue
+        }
+        if entryIP := net.ParseIP(entryHost); entryIP != nil {
+            if ip != nil && entryIP.Equal(ip) {
+                return true
+            }
+            continue
+        }
+
+        domain := strings.TrimPrefix(strings.TrimPrefix(entryHost, "*"), ".")
+        if host == domain || strings.HasSuffix(host, "."+domain) {
+            return true
+        }
+    }
+    return false
+}
+
+// proxyFunc 根据设置创建传输层使用的代理选择函数，不使用代理时返回 nil
+func proxyFunc(options ProxyOptions) (func(*http.Request) (*url.URL, error), error) {
+    if options.URL == proxyDirect {
+        return nil, nil
+    }
+
+    var proxyURL *url.URL
+    if options.URL != "" {
+        parsed, err := parseProxyURL(options.URL)
+        if err != nil {
+            return nil, err
+        }
+        proxyURL = parsed
+    }
+
+    return func(req *http.Request) (*url.URL, error) {
+        if bypassProxy(req.URL, options.NoProxy) {
+            return nil, nil
+        }
+        if proxyURL != nil {
+            return proxyURL, nil
+        }
+        return http.ProxyFromEnvironment(req)
+    }, nil
+}
+
+// SetProxy 设置代理，设置无效时返回错误，在下一次开始下载时生效
+func (fd *FastDownloader) SetProxy(options ProxyOptions) error {
+    if _, err := proxyFunc(options); err != nil {
+        return err
+    }
+
+    fd.mutex.Lock()
+    defer fd.mutex.Unlock()
+
+    fd.config.Proxy = options
+    return nil
+}
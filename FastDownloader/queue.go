@@ -0,0 +1,267 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "sort"
+)
+
+// defaultMaxActive 下载队列默认同时运行的下载数
+const defaultMaxActive = 3
+
+// queueItem 下载队列中的一项
+type queueItem struct {
+    id       int
+    priority int   // 数值越大越先开始
+    seq      int64 // 入队顺序，同优先级先入先出
+    resume   bool  // 暂停后重新排队的下载，轮到时从暂停处恢复
+}
+
+// QueueEntry 下载队列信息，用于 listQueue
+type QueueEntry struct {
+    ID       int
+    Priority int
+    Position int    // 在等待队列中的位置（从 1 开始），运行中和已暂停为 0
+    State    string // running、queued 或 paused
+    URLs     []string
+}
+
+// Enqueue 将已注册的下载器加入下载队列，运行中的下载数未达到上限时立即开始
+func (m *Manager) Enqueue(id int, priority int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    fd, ok := m.downloaders[id]
+    if !ok {
+        return fmt.Errorf("找不到下载器: %d", id)
+    }
+    if _, running := m.running[id]; running || m.queuedIndex(id) >= 0 {
+        return fmt.Errorf("下载器 %d 已在队列中", id)
+    }
+    if state := fd.GetState(); state == StateRunning || state == StatePaused {
+        return fmt.Errorf("下载器 %d 处于 %s 状态，不能加入队列", id, state)
+    }
+    delete(m.paused, id)
+
+    m.queueSeq++
+    m.queue = append(m.queue, &queueItem{
+        id:       id,
+        priority: priority,
+        seq:      m.queueSeq,
+    })
+    m.scheduleLocked()
+    return nil
+}
+
+// ResumeQueued 恢复由队列启动后被暂停的下载：重新加入等待队列（保留原优先级），
+// 名额未满时立即在后台恢复，否则等待名额。不是由队列启动的下载返回 false，由调用方直接恢复
+func (m *Manager) ResumeQueued(id int) bool {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    fd, ok := m.downloaders[id]
+    if !ok || fd.GetState() != StatePaused {
+        return false
+    }
+    if _, running := m.running[id]; running {
+        // 被带宽计划暂停时下载协程仍占用名额，由调用方直接恢复
+        fd.mutex.Lock()
+        scheduled := fd.scheduleResume != nil
+        fd.mutex.Unlock()
+        if scheduled {
+            return false
+        }
+        // 暂停后下载协程还没有退出，由它在退出时重新排队
+        m.resumed[id] = true
+        return true
+    }
+    priority, paused := m.paused[id]
+    if !paused {
+        return false
+    }
+    delete(m.paused, id)
+    m.requeueLocked(id, priority)
+    return true
+}
+
+// requeueLocked 将已暂停的下载重新加入等待队列，调用方需持有 m.mutex
+func (m *Manager) requeueLocked(id int, priority int) {
+    m.queueSeq++
+    m.queue = append(m.queue, &queueItem{
+        id:       id,
+        priority: priority,
+        seq:      m.queueSeq,
+        resume:   true,
+    })
+    m.scheduleLocked()
+}
+
+// SetPriority 修改等待中的下载的优先级，用于调整顺序或提前下载
+func (m *Manager) SetPriority(id int, priority int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    index := m.queuedIndex(id)
+    if index < 0 {
+        return fmt.Errorf("下载器 %d 不在等待队列中", id)
+    }
+    m.queue[index].priority = priority
+    return nil
+}
+
+// Promote 将等待中的下载移到队首：优先级提高到不低于队列中的最高优先级，并排在同优先级的其他下载之前
+func (m *Manager) Promote(id int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    index := m.queuedIndex(id)
+    if index < 0 {
+        return fmt.Errorf("下载器 %d 不在等待队列中", id)
+    }
+    first := m.sortedQueue()[0]
+    item := m.queue[index]
+    if item == first {
+        return nil
+    }
+    if first.priority > item.priority {
+        item.priority = first.priority
+    }
+    item.seq = first.seq - 1
+    return nil
+}
+
+// Dequeue 将等待中或已暂停的下载移出队列，已暂停的下载之后需要直接恢复，运行中的下载需要暂停或取消
+func (m *Manager) Dequeue(id int) error {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    if _, paused := m.paused[id]; paused {
+        delete(m.paused, id)
+        return nil
+    }
+    index := m.queuedIndex(id)
+    if index < 0 {
+        return fmt.Errorf("下载器 %d 不在等待队列中", id)
+    }
+    m.queue = append(m.queue[:index], m.queue[index+1:]...)
+    return nil
+}
+
+// SetMaxActive 设置下载队列同时运行的下载数，0 表示不限制，调大时立即开始等待中的下载
+func (m *Manager) SetMaxActive(maxActive int) {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    m.maxActive = maxActive
+    m.scheduleLocked()
+}
+
+// Queue 获取下载队列，运行中的下载在前，其次是按开始顺序排列的等待中的下载，最后是已暂停的下载
+func (m *Manager) Queue() []QueueEntry {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    entries := make([]QueueEntry, 0, len(m.running)+len(m.queue)+len(m.paused))
+    for id, priority := range m.running {
+        entries = append(entries, QueueEntry{
+            ID:       id,
+            Priority: priority,
+            State:    "running",
+            URLs:     m.downloaders[id].config.URLs,
+        })
+    }
+    sort.Slice(entries, func(i, j int) bool {
+        return entries[i].ID < entries[j].ID
+    })
+
+    for i, item := range m.sortedQueue() {
+        entries = append(entries, QueueEntry{
+            ID:       item.id,
+            Priority: item.priority,
+            Position: i + 1,
+            State:    "queued",
+            URLs:     m.downloaders[item.id].config.URLs,
+        })
+    }
+
+    paused := make([]QueueEntry, 0, len(m.paused))
+    for id, priority := range m.paused {
+        // 暂停后被取消的下载不再属于队列
+        if m.downloaders[id].GetState() != StatePaused {
+            delete(m.paused, id)
+            continue
+        }
+        paused = append(paused, QueueEntry{
+            ID:       id,
+            Priority: priority,
+            State:    "paused",
+            URLs:     m.downloaders[id].config.URLs,
+        })
+    }
+    sort.Slice(paused, func(i, j int) bool {
+        return paused[i].ID < paused[j].ID
+    })
+    return append(entries, paused...)
+}
+
+// queuedIndex 查找下载器在等待队列中的位置，不在队列中时返回 -1，调用方需持有 m.mutex
+func (m *Manager) queuedIndex(id int) int {
+    for i, item := range m.queue {
+        if item.id == id {
+            return i
+        }
+    }
+    return -1
+}
+
+// sortedQueue 按优先级从高到低、同优先级按入队顺序排列的等待队列副本，调用方需持有 m.mutex
+func (m *Manager) sortedQueue() []*queueItem {
+    items := append([]*queueItem(nil), m.queue...)
+    sort.Slice(items, func(i, j int) bool {
+        if items[i].priority != items[j].priority {
+            return items[i].priority > items[j].priority
+        }
+        return items[i].seq < items[j].seq
+    })
+    return items
+}
+
+// scheduleLocked 在运行中的下载数未达到上限时开始优先级最高的等待中下载，调用方需持有 m.mutex
+func (m *Manager) scheduleLocked() {
+    for len(m.queue) > 0 && (m.maxActive <= 0 || len(m.running) < m.maxActive) {
+        next := m.sortedQueue()[0]
+        index := m.queuedIndex(next.id)
+        m.queue = append(m.queue[:index], m.queue[index+1:]...)
+
+        fd, ok := m.downloaders[next.id]
+        if !ok {
+            continue
+        }
+        m.running[next.id] = next.priority
+
+        go func(item *queueItem, fd *FastDownloader) {
+            // 下载结果通过下载器的事件通知
+            var err error
+            if item.resume {
+                err = fd.ResumeDownload()
+            } else {
+                err = fd.StartDownload()
+            }
+
+            m.mutex.Lock()
+            defer m.mutex.Unlock()
+            delete(m.running, item.id)
+            resumed := m.resumed[item.id]
+            delete(m.resumed, item.id)
+            // 暂停的下载让出名额，通过 ResumeQueued 重新排队
+            if errors.Is(err, ErrPaused) && fd.GetState() == StatePaused {
+                if resumed {
+                    m.requeueLocked(item.id, item.priority)
+                    return
+                }
+                m.paused[item.id] = item.priority
+            }
+            m.scheduleLocked()
+        }(next, fd)
+    }
+}
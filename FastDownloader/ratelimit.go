@@ -0,0 +1,139 @@
+package main
+
+import (
+    "context"
+    "sync"
+    "time"
+)
+
+// minRateBurst 令牌桶的最小容量，保证一次读取（64KB缓冲区）不会超过桶容量太多
+const minRateBurst = 64 * 1024
+
+// rateLimiter 令牌桶限速器，可在下载过程中调整速度
+type rateLimiter struct {
+    mutex  sync.Mutex
+    rate   int64     // 每秒允许的字节数，0 表示不限速
+    tokens float64   // 当前可用的令牌（字节），为负数时表示已透支
+    last   time.Time // 上次补充令牌的时间
+}
+
+// newRateLimiter 创建限速器，rate 为 0 表示不限速
+func newRateLimiter(rate int64) *rateLimiter {
+    limiter := &rateLimiter{}
+    limiter.SetRate(rate)
+    return limiter
+}
+
+// burst 令牌桶容量：一秒的流量，但不小于 minRateBurst
+func (l *rateLimiter) burst() float64 {
+    if l.rate < minRateBurst {
+        return minRateBurst
+    }
+    return float64(l.rate)
+}
+
+// SetRate 调整限速，正在等待的读取在下一次读取时按新的速度计算
+func (l *rateLimiter) SetRate(rate int64) {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    if rate < 0 {
+        rate = 0
+    }
+    l.rate = rate
+    l.tokens = 0
+    l.last = time.Now()
+}
+
+// Rate 获取当前限速
+func (l *rateLimiter) Rate() int64 {
+    l.mutex.Lock()
+    defer l.mutex.Unlock()
+
+    return l.rate
+}
+
+// wait 消耗 n 个字节的令牌，令牌不足时等待到补足为止
+func (l *rateLimiter) wait(ctx context.Context, n int) error {
+    l.mutex.Lock()
+    if l.rate <= 0 {
+        l.mutex.Unlock()
+        return nil
+    }
+
+    now := time.Now()
+    l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+    if burst := l.burst(); l.tokens > burst {
+        l.tokens = burst
+    }
+    l.last = now
+    l.tokens -= float64(n)
+
+    var delay time.Duration
+    if l.tokens < 0 {
+        delay = time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+    }
+    l.mutex.Unlock()
+
+    if delay <= 0 {
+        return nil
+    }
+    timer := time.NewTimer(delay)
+    defer timer.Stop()
+    select {
+    case <-ctx.Done():
+        return ctx.Err()
+    case <-timer.C:
+        return nil
+    }
+}
+
+// SetRateLimit 调整本下载器的限速（字节/秒），0 表示不限速，下载过程中也可以调整
+func (fd *FastDownloader) SetRateLimit(bytesPerSecond int64) {
+    fd.mutex.Lock()
+    fd.config.MaxBytesPerSecond = bytesPerSecond
+    fd.mutex.Unlock()
+    fd.rate.SetRate(bytesPerSecond)
+}
+
+// waitRate 读取到 n 个字节后按本下载器、下载管理器全局以及主机的限速依次等待
+func (fd *FastDownloader) waitRate(ctx context.Context, host string, n int) error {
+    if err := fd.rate.wait(ctx, n); err != nil {
+        return err
+    }
+    if fd.manager != nil {
+        return fd.manager.waitRate(ctx, host, n)
+    }
+    return nil
+}
+
+// SetRateLimit 设置所有下载器合计的限速（字节/秒），0 表示不限速
+func (m *Manager) SetRateLimit(bytesPerSecond int64) {
+    m.rate.SetRate(bytesPerSecond)
+}
+
+// SetHostRateLimit 设置所有下载器从指定主机（含端口）下载的合计限速（字节/秒），0 表示不限速
+func (m *Manager) SetHostRateLimit(host string, bytesPerSecond int64) {
+    m.hostRateLimiter(host).SetRate(bytesPerSecond)
+}
+
+// hostRateLimiter 获取主机的限速器
+func (m *Manager) hostRateLimiter(host string) *rateLimiter {
+    m.mutex.Lock()
+    defer m.mutex.Unlock()
+
+    limiter, ok := m.hostRates[host]
+    if !ok {
+        limiter = newRateLimiter(0)
+        m.hostRates[host] = limiter
+    }
+    return limiter
+}
+
+// waitRate 按全局限速和主机限速等待
+func (m *Manager) waitRate(ctx context.Context, host string, n int) error {
+    if err := m.rate.wait(ctx, n); err != nil {
+        return err
+    }
+    return m.hostRateLimiter(host).wait(ctx, n)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "os"
+    "time"
+)
+
+// resumeStateSuffix 断点续传控制文件后缀，控制文件与保存路径放在同一目录
+const resumeStateSuffix = ".fdstate"
+
+// resumeSaveInterval 下载过程中保存控制文件的间隔
+const resumeSaveInterval = 2 * time.Second
+
+// ResumeState 断点续传控制文件内容
+type ResumeState struct {
+    URL          string
+    TotalSize    int64
+    ETag         string
+    LastModified string
+    Chunks       []DownloadChunk
+    Repairing    []int // 修复模式下重新下载的块，恢复后用于确认修复结果
+}
+
+// resumeStatePath 获取保存路径对应的控制文件路径
+func resumeStatePath(savePath string) string {
+    return savePath + resumeStateSuffix
+}
+
+// loadResumeState 读取控制文件，文件不存在或内容无效时返回 nil
+func loadResumeState(savePath string) *ResumeState {
+    data, err := os.ReadFile(resumeStatePath(savePath))
+    if err != nil {
+        return nil
+    }
+
+    var state ResumeState
+    if err := json.Unmarshal(data, &state); err != nil {
+        return nil
+    }
+    return &state
+}
+
+// changed 检查远程文件相对控制文件记录的版本是否已变化
+func (state *ResumeState) changed(info *RemoteFileInfo) bool {
+    if state.TotalSize != info.Size {
+        return true
+    }
+    if state.ETag != "" || info.ETag != "" {
+        return state.ETag != info.ETag
+    }
+    return state.LastModified != info.LastModified
+}
+
+// matches 检查控制文件是否属于当前下载，并且已下载的目标文件仍然完整存在
+func (state *ResumeState) matches(url string, totalSize int64, savePath string) bool {
+    if state.URL != url || state.TotalSize != totalSize || len(state.Chunks) == 0 {
+        return false
+    }
+
+    info, err := os.Stat(savePath)
+    if err != nil || info.Size() != totalSize {
+        return false
+    }
+
+    for _, chunk := range state.Chunks {
+        if chunk.StartOffset < 0 || chunk.EndOffset >= totalSize || chunk.Downloaded < 0 ||
+            chunk.StartOffset+chunk.Downloaded > chunk.EndOffset+1 {
+            return false
+        }
+    }
+    return true
+}
+
+// restoreChunks 从控制文件恢复块表和已下载字节数
+func (ft *fileTask) restoreChunks(state *ResumeState) {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    ft.chunks = make([]*DownloadChunk, 0, len(state.Chunks))
+    ft.downloaded = 0
+    for _, chunk := range state.Chunks {
+        // 块写完后、标记完成前保存的控制文件中，已下载的数据可能已经覆盖整个块
+        if chunk.StartOffset+chunk.Downloaded > chunk.EndOffset {
+            chunk.Done = true
+        }
+        ft.chunks = append(ft.chunks, &chunk)
+        ft.downloaded += chunk.Downloaded
+    }
+    ft.repairing = state.Repairing
+}
+
+// saveResumeState 将当前块表写入控制文件
+func (ft *fileTask) saveResumeState(file *os.File, url string, savePath string) error {
+    ft.mutex.Lock()
+    state := ResumeState{
+        URL:       url,
+        TotalSize: ft.totalSize,
+        Chunks:    make([]DownloadChunk, 0, len(ft.chunks)),
+        Repairing: ft.repairing,
+    }
+    if ft.remote != nil {
+        state.ETag = ft.remote.ETag
+        state.LastModified = ft.remote.LastModified
+    }
+    for _, chunk := range ft.chunks {
+        state.Chunks = append(state.Chunks, *chunk)
+    }
+    ft.mutex.Unlock()
+
+    // 先把已写入的数据落盘，保证控制文件记录的进度不会超前于文件内容
+    if err := file.Sync(); err != nil {
+        return fmt.Errorf("同步文件失败: %v", err)
+    }
+
+    data, err := json.Marshal(state)
+    if err != nil {
+        return fmt.Errorf("序列化控制文件失败: %v", err)
+    }
+
+    // 先写临时文件再重命名，避免中途退出留下损坏的控制文件
+    path := resumeStatePath(savePath)
+    tmpPath := path + ".tmp"
+    if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+        return fmt.Errorf("写入控制文件失败: %v", err)
+    }
+    if err := os.Rename(tmpPath, path); err != nil {
+        os.Remove(tmpPath)
+        return fmt.Errorf("写入控制文件失败: %v", err)
+    }
+    return nil
+}
+
+// removeResumeState 删除控制文件
+func removeResumeState(savePath string) {
+    os.Remove(resumeStatePath(savePath))
+}
+
+// discardPartial 删除未完成的文件及其控制文件
+func (ft *fileTask) discardPartial() {
+    // 存在控制文件说明保存路径上是未完成的文件（可能来自之前的进程）
+    _, err := os.Stat(resumeStatePath(ft.savePath))
+    if ft.partialFile || err == nil {
+        os.Remove(ft.savePath)
+    }
+    removeResumeState(ft.savePath)
+    ft.resetFileState()
+}
+
+// discardPartial 删除所有已开始但未完成的文件及其控制文件
+func (fd *FastDownloader) discardPartial() {
+    fd.mutex.Lock()
+    tasks := make([]*fileTask, 0, len(fd.tasks))
+    for i, task := range fd.tasks {
+        if task != nil {
+            tasks = append(tasks, task)
+            fd.tasks[i] = nil
+        }
+    }
+    fd.mutex.Unlock()
+
+    for _, task := range tasks {
+        task.discardPartial()
+    }
+}
+
+// startAutoSave 启动定期保存控制文件的协程，返回的函数用于停止并等待协程退出
+func (ft *fileTask) startAutoSave(file *os.File, url string, savePath string) func() {
+    stop := make(chan struct{})
+    done := make(chan struct{})
+
+    go func() {
+        defer close(done)
+        ticker := time.NewTicker(resumeSaveInterval)
+        defer ticker.Stop()
+
+        for {
+            select {
+            case <-stop:
+                return
+            case <-ticker.C:
+                if err := ft.saveResumeState(file, url, savePath); err != nil {
+                    ft.send(Event{
+                        Type: EventTypeMsg,
+                        Name: "警告",
+                    }, map[string]interface{}{
+                        "Text": fmt.Sprintf("保存控制文件失败: %v", err),
+                    })
+                }
+            }
+        }
+    }()
+
+    return func() {
+        close(stop)
+        <-done
+    }
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+    "bytes"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "path/filepath"
+    "testing"
+    "time"
+)
+
+// TestResumeFullChunkNotDone 控制文件中已写完但未标记完成的块在恢复时视为已完成，不再请求空的范围
+func TestResumeFullChunkNotDone(t *testing.T) {
+    data := bytes.Repeat([]byte("0123456789abcdef"), 512)
+    modified := time.Unix(1700000000, 0)
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        http.ServeContent(w, r, "file", modified, bytes.NewReader(data))
+    }))
+    defer srv.Close()
+
+    url := srv.URL + "/file"
+    savePath := filepath.Join(t.TempDir(), "file")
+    half := int64(len(data) / 2)
+    partial := make([]byte, len(data))
+    copy(partial, data[:half])
+    if err := os.WriteFile(savePath, partial, 0644); err != nil {
+        t.Fatal(err)
+    }
+    state, err := json.Marshal(ResumeState{
+        URL:          url,
+        TotalSize:    int64(len(data)),
+        LastModified: modified.UTC().Format(http.TimeFormat),
+        Chunks: []DownloadChunk{
+            {StartOffset: 0, EndOffset: half - 1, Downloaded: half},
+            {StartOffset: half, EndOffset: int64(len(data)) - 1},
+        },
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := os.WriteFile(resumeStatePath(savePath), state, 0644); err != nil {
+        t.Fatal(err)
+    }
+
+    fd := NewFastDownloader(&DownloadConfig{
+        URLs:         []string{url},
+        SavePaths:    []string{savePath},
+        ThreadCount:  2,
+        ChunkSizeMB:  1,
+        MaxRetries:   -1,
+        CallbackFunc: func(Event, map[string]interface{}) {},
+    })
+    if err := fd.StartDownload(); err != nil {
+        t.Fatalf("下载失败: %v", err)
+    }
+    saved, err := os.ReadFile(savePath)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(saved, data) {
+        t.Error("下载的文件内容不一致")
+    }
+}
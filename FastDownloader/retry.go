@@ -0,0 +1,193 @@
+package main
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "io/fs"
+    "math/rand"
+    "net/http"
+    "os"
+    "time"
+)
+
+// 重试策略默认值
+const (
+    defaultMaxRetries     = 5
+    defaultRetryBaseDelay = 500 * time.Millisecond
+    defaultRetryMaxDelay  = 30 * time.Second
+)
+
+// errShortRead 响应在块结束之前就已结束
+var errShortRead = errors.New("响应数据不完整")
+
+// httpStatusError 块请求返回了非预期的HTTP状态码
+type httpStatusError struct {
+    StatusCode int
+    RetryAfter time.Duration // 服务器通过 Retry-After 要求的等待时间
+}
+
+func (e *httpStatusError) Error() string {
+    return fmt.Sprintf("HTTP错误: %d", e.StatusCode)
+}
+
+// isRetryable 判断块下载错误是否可以重试
+func isRetryable(err error) bool {
+    if errors.Is(err, context.Canceled) || errors.Is(err, errResourceChanged) || errors.Is(err, errRangeNotSupported) {
+        return false
+    }
+    if isCertificateError(err) {
+        return false
+    }
+
+    // 写入本地文件失败（磁盘已满、权限等）重试没有意义
+    var pathErr *fs.PathError
+    if errors.As(err, &pathErr) {
+        return false
+    }
+
+    var statusErr *httpStatusError
+    if errors.As(err, &statusErr) {
+        return statusErr.StatusCode >= 500 ||
+            statusErr.StatusCode == http.StatusRequestTimeout ||
+            statusErr.StatusCode == http.StatusTooManyRequests
+    }
+
+    // 其余为网络错误、连接重置、响应不完整等临时错误
+    return true
+}
+
+// maxRetries 获取每个块的最大重试次数
+func (fd *FastDownloader) maxRetries() int {
+    switch {
+    case fd.config.MaxRetries < 0:
+        return 0
+    case fd.config.MaxRetries == 0:
+        return defaultMaxRetries
+    default:
+        return fd.config.MaxRetries
+    }
+}
+
+// retryDelay 计算第 attempt 次重试前的等待时间：指数退避，并在后一半区间内随机抖动
+func (fd *FastDownloader) retryDelay(attempt int) time.Duration {
+    baseDelay := fd.config.RetryBaseDelay
+    if baseDelay <= 0 {
+        baseDelay = defaultRetryBaseDelay
+    }
+    maxDelay := fd.config.RetryMaxDelay
+    if maxDelay <= 0 {
+        maxDelay = defaultRetryMaxDelay
+    }
+
+    delay := baseDelay
+    for i := 1; i < attempt && delay < maxDelay; i++ {
+        delay *= 2
+    }
+    if delay > maxDelay {
+        delay = maxDelay
+    }
+
+    half := delay / 2
+    return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// downloadChunkWithRetry 下载指定块，遇到临时错误时按退避策略重试，
+// 每次重试都从块当前的写入位置继续，并按评分重新选择镜像；
+// 服务器限流时按 Retry-After 等待，不计入重试次数
+func (ft *fileTask) downloadChunkWithRetry(ctx context.Context, file *os.File, chunkIndex int, worker *WorkerStat) error {
+    maxRetries := ft.fd.maxRetries()
+    attempt := 0
+    throttles := 0
+
+    for {
+        m := ft.pickMirror()
+        if m == nil {
+            return errNoMirror
+        }
+        host := hostOf(m.URL)
+        ft.mutex.Lock()
+        worker.Mirror = m.URL
+        ft.mutex.Unlock()
+
+        err := ft.downloadChunk(ctx, file, chunkIndex, m, worker)
+        ft.releaseMirror(m, err)
+        if err == nil {
+            ft.fd.hostSucceeded(host)
+            ft.mirrorSucceeded(m)
+            return nil
+        }
+        if ctx.Err() != nil {
+            return err
+        }
+
+        // 镜像本身不可用时停用它并立即换下一个镜像，只剩这一个镜像时按原有逻辑处理
+        if isMirrorFatal(err) && ft.dropMirror(m, err) {
+            continue
+        }
+
+        var statusErr *httpStatusError
+        if errors.As(err, &statusErr) && isThrottleStatus(statusErr.StatusCode) && throttles < maxThrottleRetries {
+            throttles++
+            delay := statusErr.RetryAfter
+            if delay <= 0 {
+                delay = ft.fd.retryDelay(throttles)
+            }
+            concurrency := ft.fd.throttleHost(host, delay)
+
+            ft.send(Event{
+                Type: EventTypeThrottled,
+                Name: "服务器限流",
+            }, map[string]interface{}{
+                "Chunk":       chunkIndex,
+                "Host":        host,
+                "StatusCode":  statusErr.StatusCode,
+                "Delay":       delay.Milliseconds(),
+                "Concurrency": concurrency,
+            })
+
+            select {
+            case <-ctx.Done():
+                return ctx.Err()
+            case <-time.After(delay):
+            }
+            continue
+        }
+
+        ft.mirrorFailed(m, err)
+        attempt++
+        if !isRetryable(err) || attempt > maxRetries {
+            ft.send(Event{
+                Type: EventTypeMsg,
+                Name: "错误",
+            }, map[string]interface{}{
+                "Text": fmt.Sprintf("下载块失败:%d: %v\n", chunkIndex, err),
+            })
+            return err
+        }
+
+        delay := ft.fd.retryDelay(attempt)
+        ft.mutex.Lock()
+        chunk := ft.chunks[chunkIndex]
+        offset := chunk.StartOffset + chunk.Downloaded
+        ft.mutex.Unlock()
+
+        ft.send(Event{
+            Type: EventTypeRetry,
+            Name: "重试块",
+        }, map[string]interface{}{
+            "Chunk":      chunkIndex,
+            "Attempt":    attempt,
+            "MaxRetries": maxRetries,
+            "Offset":     offset,
+            "Delay":      delay.Milliseconds(),
+            "Error":      err.Error(),
+        })
+
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(delay):
+        }
+    }
+}
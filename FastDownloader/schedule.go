@@ -0,0 +1,282 @@
+package main
+
+import (
+    "errors"
+    "fmt"
+    "time"
+)
+
+// scheduleCheckInterval 检查带宽计划的间隔
+const scheduleCheckInterval = time.Second
+
+// BandwidthRule 带宽计划中的一个时间段
+type BandwidthRule struct {
+    Start          string // 开始时间（本地时间，HH:MM）
+    End            string // 结束时间（HH:MM，不含），早于开始时间表示跨越午夜
+    Days           []int  // 生效的星期（0 表示周日），为空表示每天
+    BytesPerSecond int64  // 该时间段的限速（字节/秒），0 表示不限速
+    Pause          bool   // 该时间段暂停下载
+}
+
+// parseClock 解析 HH:MM 格式的时间，返回从零点开始的分钟数。24:00 表示一天结束
+func parseClock(value string) (int, error) {
+    if value == "24:00" {
+        return 24 * 60, nil
+    }
+    clock, err := time.Parse("15:04", value)
+    if err != nil {
+        return 0, fmt.Errorf("无法解析时间: %q", value)
+    }
+    return clock.Hour()*60 + clock.Minute(), nil
+}
+
+// validate 检查时间段的格式
+func (rule BandwidthRule) validate() error {
+    if _, err := parseClock(rule.Start); err != nil {
+        return err
+    }
+    if _, err := parseClock(rule.End); err != nil {
+        return err
+    }
+    for _, day := range rule.Days {
+        if day < 0 || day > 6 {
+            return fmt.Errorf("无效的星期: %d", day)
+        }
+    }
+    if rule.BytesPerSecond < 0 {
+        return fmt.Errorf("无效的限速: %d", rule.BytesPerSecond)
+    }
+    return nil
+}
+
+// matches 判断时间是否落在该时间段内。跨越午夜的时间段按开始时间所在的日期判断星期
+func (rule BandwidthRule) matches(now time.Time) bool {
+    start, err := parseClock(rule.Start)
+    if err != nil {
+        return false
+    }
+    end, err := parseClock(rule.End)
+    if err != nil {
+        return false
+    }
+
+    minute := now.Hour()*60 + now.Minute()
+    day := now.Weekday()
+    switch {
+    case start == end:
+        // 开始和结束相同表示全天
+    case start < end:
+        if minute < start || minute >= end {
+            return false
+        }
+    default:
+        if minute < start && minute >= end {
+            return false
+        }
+        if minute < end {
+            // 午夜之后的部分属于前一天开始的时间段
+            day = (day + 6) % 7
+        }
+    }
+
+    if len(rule.Days) == 0 {
+        return true
+    }
+    for _, d := range rule.Days {
+        if time.Weekday(d) == day {
+            return true
+        }
+    }
+    return false
+}
+
+// ValidateSchedule 检查带宽计划的格式
+func ValidateSchedule(rules []BandwidthRule) error {
+    for i, rule := range rules {
+        if err := rule.validate(); err != nil {
+            return fmt.Errorf("带宽计划第 %d 项: %v", i+1, err)
+        }
+    }
+    return nil
+}
+
+// SetSchedule 设置带宽计划，下载过程中设置时立即生效
+func (fd *FastDownloader) SetSchedule(rules []BandwidthRule) error {
+    if err := ValidateSchedule(rules); err != nil {
+        return err
+    }
+
+    fd.mutex.Lock()
+    fd.config.Schedule = rules
+    running := fd.scheduleRuns > 0
+    if running && len(rules) > 0 && fd.scheduleStop == nil {
+        fd.scheduleStop = fd.launchSchedule()
+    }
+    fd.mutex.Unlock()
+
+    // 下载过程中修改时立即生效
+    if running {
+        fd.applySchedule()
+    }
+    return nil
+}
+
+// activeRule 查找当前生效的时间段，多个时间段重叠时以靠前的为准，没有时返回 -1
+func (fd *FastDownloader) activeRule(now time.Time) (int, BandwidthRule) {
+    fd.mutex.Lock()
+    defer fd.mutex.Unlock()
+
+    for i, rule := range fd.config.Schedule {
+        if rule.matches(now) {
+            return i, rule
+        }
+    }
+    return -1, BandwidthRule{BytesPerSecond: fd.config.MaxBytesPerSecond}
+}
+
+// applySchedule 按当前时间应用带宽计划：调整限速，进入暂停时间段时暂停下载，离开时恢复
+func (fd *FastDownloader) applySchedule() {
+    fd.scheduleMutex.Lock()
+    defer fd.scheduleMutex.Unlock()
+
+    index, rule := fd.activeRule(time.Now())
+    fd.mutex.Lock()
+    lastRule := fd.scheduleRule
+    fd.scheduleRule = index
+    fd.mutex.Unlock()
+    if index != lastRule {
+        fd.rate.SetRate(rule.BytesPerSecond)
+        SendMessage(fd, Event{
+            Type: EventTypeSchedule,
+            Name: "带宽计划",
+        }, map[string]interface{}{
+            "Rule":           index,
+            "BytesPerSecond": rule.BytesPerSecond,
+            "Pause":          rule.Pause,
+            "Start":          rule.Start,
+            "End":            rule.End,
+        })
+    }
+
+    fd.mutex.Lock()
+    resume := fd.scheduleResume
+    fd.mutex.Unlock()
+
+    switch {
+    case rule.Pause && resume == nil && fd.GetState() == StateRunning:
+        // 先记录再暂停，保证下载协程返回时能看到是带宽计划暂停的
+        fd.mutex.Lock()
+        fd.scheduleResume = make(chan struct{})
+        fd.mutex.Unlock()
+        if err := fd.PauseDownload(); err != nil {
+            fd.mutex.Lock()
+            fd.scheduleResume = nil
+            fd.mutex.Unlock()
+        }
+    case !rule.Pause && resume != nil:
+        fd.mutex.Lock()
+        fd.scheduleResume = nil
+        fd.mutex.Unlock()
+        close(resume)
+    }
+}
+
+// launchSchedule 启动定时检查带宽计划的协程，返回的函数用于停止协程。调用方需持有 fd.mutex
+func (fd *FastDownloader) launchSchedule() func() {
+    stop := make(chan struct{})
+    done := make(chan struct{})
+
+    go func() {
+        defer close(done)
+        ticker := time.NewTicker(scheduleCheckInterval)
+        defer ticker.Stop()
+
+        for {
+            select {
+            case <-stop:
+                return
+            case <-ticker.C:
+                fd.applySchedule()
+            }
+        }
+    }()
+
+    return func() {
+        close(stop)
+        <-done
+    }
+}
+
+// startSchedule 开始一个下载批次时调用：设置了带宽计划时启动定时检查的协程（首次检查由 runBatch
+// 在切换到下载中之后进行）。返回的函数在批次结束时调用，最后一个批次结束时停止协程并恢复配置的限速
+func (fd *FastDownloader) startSchedule() func() {
+    fd.mutex.Lock()
+    fd.scheduleRuns++
+    if fd.scheduleRuns == 1 {
+        fd.scheduleRule = -1
+    }
+    if len(fd.config.Schedule) > 0 && fd.scheduleStop == nil {
+        fd.scheduleStop = fd.launchSchedule()
+    }
+    fd.mutex.Unlock()
+
+    return func() {
+        fd.mutex.Lock()
+        fd.scheduleRuns--
+        if fd.scheduleRuns > 0 {
+            fd.mutex.Unlock()
+            return
+        }
+        stop := fd.scheduleStop
+        fd.scheduleStop = nil
+        fd.mutex.Unlock()
+
+        if stop != nil {
+            stop()
+        }
+        fd.mutex.Lock()
+        fd.scheduleResume = nil
+        rate := fd.config.MaxBytesPerSecond
+        fd.mutex.Unlock()
+        fd.rate.SetRate(rate)
+    }
+}
+
+// waitScheduledResume 下载被带宽计划暂停时等待暂停时间段结束，返回 true 表示应继续下载；
+// 手动暂停或等待期间被取消、手动恢复时返回 false
+func (fd *FastDownloader) waitScheduledResume() bool {
+    fd.mutex.Lock()
+    resume := fd.scheduleResume
+    fd.mutex.Unlock()
+    if resume == nil {
+        return false
+    }
+
+    ticker := time.NewTicker(scheduleCheckInterval)
+    defer ticker.Stop()
+    for {
+        select {
+        case <-resume:
+            return fd.GetState() == StatePaused
+        case <-ticker.C:
+            if fd.GetState() != StatePaused {
+                return false
+            }
+        }
+    }
+}
+
+// runScheduled 运行下载批次，被带宽计划暂停时在暂停时间段结束后自动恢复，调用方一直阻塞到下载结束
+func (fd *FastDownloader) runScheduled(resume bool) error {
+    stopSchedule := fd.startSchedule()
+    defer stopSchedule()
+
+    err := fd.runBatch(resume)
+    for errors.Is(err, ErrPaused) && fd.waitScheduledResume() {
+        err = fd.runBatch(true)
+    }
+    if errors.Is(err, ErrPaused) && fd.GetState() == StateCancelled {
+        err = ErrCancelled
+    }
+    return err
+}
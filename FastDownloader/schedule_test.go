@@ -0,0 +1,41 @@
+package main
+
+import (
+    "path/filepath"
+    "testing"
+)
+
+// TestParseClock 解析 HH:MM 格式的时间
+func TestParseClock(t *testing.T) {
+    valid := map[string]int{"00:00": 0, "9:05": 9*60 + 5, "23:59": 23*60 + 59, "24:00": 24 * 60}
+    for value, minutes := range valid {
+        got, err := parseClock(value)
+        if err != nil || got != minutes {
+            t.Errorf("parseClock(%q) = %d, %v", value, got, err)
+        }
+    }
+    for _, value := range []string{"", "9", "9:00x", "25:00", "24:01", "12:60", "-1:00", " 9:00"} {
+        if _, err := parseClock(value); err == nil {
+            t.Errorf("parseClock(%q) 应当返回错误", value)
+        }
+    }
+}
+
+// TestInvalidScheduleInConfig 配置中的带宽计划无效时开始下载返回错误
+func TestInvalidScheduleInConfig(t *testing.T) {
+    fd := NewFastDownloader(&DownloadConfig{
+        URLs:         []string{"http://127.0.0.1:1/file"},
+        SavePaths:    []string{filepath.Join(t.TempDir(), "file")},
+        ThreadCount:  1,
+        ChunkSizeMB:  1,
+        MaxRetries:   -1,
+        CallbackFunc: func(Event, map[string]interface{}) {},
+        Schedule:     []BandwidthRule{{Start: "09:00", End: "25:00", Pause: true}},
+    })
+    if err := fd.StartDownload(); err == nil {
+        t.Fatal("带宽计划无效时应当返回错误")
+    }
+    if state := fd.GetState(); state != StateIdle {
+        t.Errorf("校验失败后的状态: %s", state)
+    }
+}
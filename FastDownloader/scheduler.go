@@ -0,0 +1,193 @@
+package main
+
+import (
+    "context"
+    "fmt"
+    "os"
+    "sync"
+)
+
+// minSplitSize 拆分块时每一半的最小字节数，剩余不足两倍时不再拆分
+const minSplitSize int64 = 1024 * 1024
+
+// WorkerStat 工作线程统计信息
+type WorkerStat struct {
+    ID         int    // 工作线程编号（从1开始）
+    Chunk      int    // 当前正在下载的块索引，-1 表示空闲
+    Chunks     int    // 已完成的块数量
+    Downloaded int64  // 已下载的字节数
+    Mirror     string // 当前块使用的镜像地址，空闲时为空
+}
+
+// initQueue 根据块表初始化待下载队列和工作线程统计
+func (ft *fileTask) initQueue(workerCount int) {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    ft.pending = nil
+    for i, chunk := range ft.chunks {
+        if !chunk.Done {
+            ft.pending = append(ft.pending, i)
+        }
+    }
+
+    ft.workers = make([]*WorkerStat, workerCount)
+    for i := range ft.workers {
+        ft.workers[i] = &WorkerStat{
+            ID:    i + 1,
+            Chunk: -1,
+        }
+    }
+}
+
+// nextChunk 从队列中取出下一个待下载的块，队列为空时尝试拆分正在下载的最大块，
+// 没有可领取的块时返回 false
+func (ft *fileTask) nextChunk(worker *WorkerStat) (int, bool) {
+    ft.mutex.Lock()
+
+    if len(ft.pending) > 0 {
+        chunkIndex := ft.pending[0]
+        ft.pending = ft.pending[1:]
+        worker.Chunk = chunkIndex
+        ft.mutex.Unlock()
+        return chunkIndex, true
+    }
+
+    sourceIndex, newIndex, ok := ft.splitLargestChunk()
+    if !ok {
+        worker.Chunk = -1
+        ft.mutex.Unlock()
+        return -1, false
+    }
+    worker.Chunk = newIndex
+    newChunk := *ft.chunks[newIndex]
+    ft.mutex.Unlock()
+
+    ft.send(Event{
+        Type: EventTypeSplit,
+        Name: "拆分块",
+    }, map[string]interface{}{
+        "Chunk":       sourceIndex,
+        "NewChunk":    newIndex,
+        "StartOffset": newChunk.StartOffset,
+        "EndOffset":   newChunk.EndOffset,
+        "Worker":      worker.ID,
+    })
+
+    return newIndex, true
+}
+
+// splitLargestChunk 在当前写入位置之后将剩余量最大的在途块一分为二，
+// 后半部分作为新块追加到块表。调用方需持有 ft.mutex
+func (ft *fileTask) splitLargestChunk() (int, int, bool) {
+    // 单连接下载时不能拆分
+    if ft.singleStream {
+        return -1, -1, false
+    }
+
+    sourceIndex := -1
+    var largest int64
+    for _, w := range ft.workers {
+        if w.Chunk < 0 {
+            continue
+        }
+        chunk := ft.chunks[w.Chunk]
+        if chunk.Done {
+            continue
+        }
+        remaining := chunk.EndOffset - (chunk.StartOffset + chunk.Downloaded) + 1
+        if remaining > largest {
+            largest = remaining
+            sourceIndex = w.Chunk
+        }
+    }
+
+    if sourceIndex < 0 || largest < 2*minSplitSize {
+        return -1, -1, false
+    }
+
+    source := ft.chunks[sourceIndex]
+    splitOffset := source.StartOffset + source.Downloaded + largest/2
+    newChunk := &DownloadChunk{
+        StartOffset: splitOffset,
+        EndOffset:   source.EndOffset,
+    }
+    source.EndOffset = splitOffset - 1
+    ft.chunks = append(ft.chunks, newChunk)
+
+    return sourceIndex, len(ft.chunks) - 1, true
+}
+
+// finishChunk 记录工作线程完成了一个块
+func (ft *fileTask) finishChunk(worker *WorkerStat) {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    worker.Chunks++
+    worker.Chunk = -1
+    worker.Mirror = ""
+}
+
+// workerSnapshot 获取工作线程统计信息的副本，用于进度事件
+func (ft *fileTask) workerSnapshot() []WorkerStat {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    stats := make([]WorkerStat, 0, len(ft.workers))
+    for _, worker := range ft.workers {
+        stats = append(stats, *worker)
+    }
+    return stats
+}
+
+// runWorkers 启动固定数量的工作线程，每个线程不断从队列领取块，直到所有块下载完成
+func (ft *fileTask) runWorkers(ctx context.Context, file *os.File, workerCount int) error {
+    ctx, cancel := context.WithCancel(ctx)
+    defer cancel()
+
+    ft.initQueue(workerCount)
+
+    var wg sync.WaitGroup
+    errChan := make(chan error, workerCount)
+
+    for _, worker := range ft.workers {
+        wg.Add(1)
+        go func(worker *WorkerStat) {
+            defer wg.Done()
+            for {
+                chunkIndex, ok := ft.nextChunk(worker)
+                if !ok {
+                    return
+                }
+
+                if err := ft.downloadChunkWithRetry(ctx, file, chunkIndex, worker); err != nil {
+                    select {
+                    case errChan <- err:
+                    default:
+                    }
+                    // 任意一个块失败时停止其他工作线程
+                    cancel()
+                    return
+                }
+                ft.finishChunk(worker)
+            }
+        }(worker)
+    }
+
+    // 等待所有工作线程退出
+    wg.Wait()
+    close(errChan)
+
+    // 检查是否有错误
+    if len(errChan) > 0 {
+        return <-errChan
+    }
+
+    for i, chunk := range ft.chunks {
+        if !chunk.Done {
+            return fmt.Errorf("块 %d 未完成下载", i)
+        }
+    }
+
+    return nil
+}
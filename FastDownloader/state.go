@@ -0,0 +1,142 @@
+package main
+
+import (
+    "fmt"
+)
+
+// DownloadState 下载器状态
+type DownloadState int
+
+// 定义下载器状态常量，数值即 getDownloadState 的返回值
+const (
+    StateIdle      DownloadState = iota // 已创建，尚未开始
+    StateRunning                        // 下载中
+    StatePaused                         // 已暂停，已下载的数据保存在控制文件中
+    StateCompleted                      // 全部下载完成
+    StateFailed                         // 下载失败
+    StateCancelled                      // 已取消
+)
+
+// String 返回状态名称，用于事件数据
+func (s DownloadState) String() string {
+    switch s {
+    case StateIdle:
+        return "idle"
+    case StateRunning:
+        return "running"
+    case StatePaused:
+        return "paused"
+    case StateCompleted:
+        return "completed"
+    case StateFailed:
+        return "failed"
+    case StateCancelled:
+        return "cancelled"
+    default:
+        return "unknown"
+    }
+}
+
+// stateTransitions 允许的状态转换
+var stateTransitions = map[DownloadState][]DownloadState{
+    StateIdle:      {StateRunning},
+    StateRunning:   {StatePaused, StateCompleted, StateFailed, StateCancelled},
+    // 暂停请求与下载完成同时发生时允许直接进入完成状态
+    StatePaused:    {StateRunning, StateCancelled, StateCompleted},
+    StateCompleted: {StateRunning},
+    StateFailed:    {StateRunning},
+    StateCancelled: {StateRunning},
+}
+
+// canTransition 检查状态转换是否合法
+func canTransition(from DownloadState, to DownloadState) bool {
+    for _, state := range stateTransitions[from] {
+        if state == to {
+            return true
+        }
+    }
+    return false
+}
+
+// transitionEvent 获取状态转换对应的事件
+func transitionEvent(from DownloadState, to DownloadState) Event {
+    switch to {
+    case StateRunning:
+        if from == StatePaused {
+            return Event{Type: EventTypeResumed, Name: "恢复下载"}
+        }
+        return Event{Type: EventTypeRunning, Name: "下载中"}
+    case StatePaused:
+        return Event{Type: EventTypePaused, Name: "下载已暂停"}
+    case StateCompleted:
+        return Event{Type: EventTypeCompleted, Name: "下载已完成"}
+    case StateFailed:
+        return Event{Type: EventTypeFailed, Name: "下载失败"}
+    case StateCancelled:
+        return Event{Type: EventTypeCancelled, Name: "下载已取消"}
+    default:
+        return Event{Type: EventTypeMsg, Name: "状态变化"}
+    }
+}
+
+// GetState 获取下载器当前状态
+func (fd *FastDownloader) GetState() DownloadState {
+    fd.stateMutex.Lock()
+    defer fd.stateMutex.Unlock()
+
+    return fd.state
+}
+
+// beginRun 登记一次开始或恢复请求。下载中或已有请求在等待切换到下载中时返回错误，
+// 保证同一时间只有一个请求能进入下载中状态
+func (fd *FastDownloader) beginRun() error {
+    fd.stateMutex.Lock()
+    defer fd.stateMutex.Unlock()
+
+    if fd.state == StateRunning || fd.runPending {
+        return fmt.Errorf("下载正在进行中")
+    }
+    fd.runPending = true
+    return nil
+}
+
+// endRun 请求已切换到下载中或已放弃时调用，允许新的开始或恢复请求
+func (fd *FastDownloader) endRun() {
+    fd.stateMutex.Lock()
+    fd.runPending = false
+    fd.stateMutex.Unlock()
+}
+
+// configure 修改下载配置。下载协程读取配置时不加锁，因此下载中、已暂停或正在开始时返回错误
+func (fd *FastDownloader) configure(update func(config *DownloadConfig)) error {
+    fd.mutex.Lock()
+    defer fd.mutex.Unlock()
+    fd.stateMutex.Lock()
+    defer fd.stateMutex.Unlock()
+
+    if fd.state == StateRunning || fd.state == StatePaused || fd.runPending {
+        return fmt.Errorf("下载中或已暂停时不能修改下载设置")
+    }
+    update(fd.config)
+    return nil
+}
+
+// setState 按状态机规则切换状态，并发送对应的状态事件
+func (fd *FastDownloader) setState(to DownloadState, data map[string]interface{}) error {
+    fd.stateMutex.Lock()
+    from := fd.state
+    if !canTransition(from, to) {
+        fd.stateMutex.Unlock()
+        return fmt.Errorf("无法从 %s 状态切换到 %s 状态", from, to)
+    }
+    fd.state = to
+    fd.stateMutex.Unlock()
+
+    if data == nil {
+        data = map[string]interface{}{}
+    }
+    data["From"] = from.String()
+    data["To"] = to.String()
+    SendMessage(fd, transitionEvent(from, to), data)
+    return nil
+}
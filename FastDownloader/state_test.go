@@ -0,0 +1,125 @@
+package main
+
+import (
+    "bytes"
+    "net/http"
+    "net/http/httptest"
+    "path/filepath"
+    "sync"
+    "testing"
+    "time"
+)
+
+// TestStartWhileRunning 下载中再次开始时立即返回错误，不会在下载结束后重新下载一遍
+func TestStartWhileRunning(t *testing.T) {
+    data := bytes.Repeat([]byte("data"), 1024)
+    release := make(chan struct{})
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == http.MethodGet {
+            <-release
+        }
+        http.ServeContent(w, r, "file", time.Unix(1700000000, 0), bytes.NewReader(data))
+    }))
+    defer srv.Close()
+
+    var mutex sync.Mutex
+    completed := 0
+    fd := NewFastDownloader(&DownloadConfig{
+        URLs:        []string{srv.URL + "/file"},
+        SavePaths:   []string{filepath.Join(t.TempDir(), "file")},
+        ThreadCount: 1,
+        ChunkSizeMB: 1,
+        MaxRetries:  -1,
+        CallbackFunc: func(event Event, data map[string]interface{}) {
+            if event.Type == EventTypeCompleted {
+                mutex.Lock()
+                completed++
+                mutex.Unlock()
+            }
+        },
+    })
+
+    results := make(chan error, 2)
+    for i := 0; i < 2; i++ {
+        go func() {
+            results <- fd.StartDownload()
+        }()
+    }
+
+    // 其中一次开始必须在另一次下载中时立即被拒绝
+    select {
+    case err := <-results:
+        if err == nil {
+            t.Fatal("下载中再次开始应当返回错误")
+        }
+    case <-time.After(5 * time.Second):
+        close(release)
+        t.Fatal("下载中再次开始没有被立即拒绝")
+    }
+    if err := fd.ResumeDownload(); err == nil {
+        t.Error("下载中恢复应当返回错误")
+    }
+
+    close(release)
+    if err := <-results; err != nil {
+        t.Fatalf("下载失败: %v", err)
+    }
+    if state := fd.GetState(); state != StateCompleted {
+        t.Errorf("下载结束后的状态: %s", state)
+    }
+    mutex.Lock()
+    defer mutex.Unlock()
+    if completed != 1 {
+        t.Errorf("下载完成事件次数: %d", completed)
+    }
+}
+
+// TestConfigureWhileRunning 下载中和已暂停时不能修改配置
+func TestConfigureWhileRunning(t *testing.T) {
+    data := bytes.Repeat([]byte("data"), 1024)
+    release := make(chan struct{})
+    srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method == http.MethodGet {
+            <-release
+        }
+        http.ServeContent(w, r, "file", time.Unix(1700000000, 0), bytes.NewReader(data))
+    }))
+    defer srv.Close()
+    defer close(release)
+
+    fd := NewFastDownloader(&DownloadConfig{
+        URLs:         []string{srv.URL + "/file"},
+        SavePaths:    []string{filepath.Join(t.TempDir(), "file")},
+        ThreadCount:  1,
+        ChunkSizeMB:  1,
+        MaxRetries:   -1,
+        CallbackFunc: func(Event, map[string]interface{}) {},
+    })
+    update := func(config *DownloadConfig) { config.MaxRetries = 3 }
+    if err := fd.configure(update); err != nil {
+        t.Fatalf("开始之前修改配置失败: %v", err)
+    }
+
+    result := make(chan error, 1)
+    go func() {
+        result <- fd.StartDownload()
+    }()
+    deadline := time.Now().Add(5 * time.Second)
+    for fd.GetState() != StateRunning {
+        if time.Now().After(deadline) {
+            t.Fatal("下载没有开始")
+        }
+        time.Sleep(10 * time.Millisecond)
+    }
+    if err := fd.configure(update); err == nil {
+        t.Error("下载中修改配置应当返回错误")
+    }
+
+    if err := fd.PauseDownload(); err != nil {
+        t.Fatal(err)
+    }
+    <-result
+    if err := fd.configure(update); err == nil {
+        t.Error("已暂停时修改配置应当返回错误")
+    }
+}
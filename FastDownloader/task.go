@@ -0,0 +1,62 @@
+package main
+
+import (
+    "sync"
+    "sync/atomic"
+    "time"
+)
+
+// fileTask 单个文件的下载状态，同时下载多个文件时每个文件各有一份
+type fileTask struct {
+    fd              *FastDownloader
+    index           int    // 文件在 URLs 中的索引
+    url             string
+    savePath        string
+    totalSize       int64
+    downloaded      int64
+    lastDownloaded  int64
+    startDownloaded int64           // 本次启动时已下载的字节数（断点续传时不为0）
+    startTime       time.Time
+    remote          *RemoteFileInfo // 远程文件信息
+    chunks          []*DownloadChunk
+    mutex           sync.Mutex
+    progressMutex   sync.Mutex
+    partialFile     bool          // 保存路径上是否有本下载器写入的未完成文件
+    pending         []int         // 待下载块队列（块索引）
+    workers         []*WorkerStat // 工作线程统计
+    singleStream    bool          // 服务器不支持 Range，使用单连接完整下载
+    mirrors         []*mirror     // 可用地址（主地址和镜像）
+    sidecarChecksum string        // 校验文件中的校验和（"算法:十六进制值"）
+    repairing       []int         // 修复模式下重新下载的块（块哈希清单中的序号），不在修复时为 nil
+}
+
+// newFileTask 创建指定索引文件的下载任务
+func (fd *FastDownloader) newFileTask(index int) *fileTask {
+    return &fileTask{
+        fd:       fd,
+        index:    index,
+        url:      fd.config.URLs[index],
+        savePath: fd.config.SavePaths[index],
+    }
+}
+
+// send 发送属于该文件的事件，事件数据中带有文件索引 FileIndex（从 0 开始）
+func (ft *fileTask) send(event Event, data map[string]interface{}) {
+    data["FileIndex"] = ft.index
+    SendMessage(ft.fd, event, data)
+}
+
+// fileData 文件的事件数据
+func (ft *fileTask) fileData() map[string]interface{} {
+    ft.mutex.Lock()
+    defer ft.mutex.Unlock()
+
+    return map[string]interface{}{
+        "Index":      ft.index + 1,
+        "FileIndex":  ft.index,
+        "Total":      len(ft.fd.config.URLs),
+        "Downloaded": atomic.LoadInt64(&ft.downloaded),
+        "Size":       ft.totalSize,
+        "URL":        ft.url,
+    }
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+    "context"
+    "net/http"
+    "net/url"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// maxThrottleRetries 单个块因限流（429/503）等待的最大次数，限流等待不计入普通重试次数
+const maxThrottleRetries = 30
+
+// throttleRecoverSuccesses 被限流的主机每成功完成多少个块恢复一个并发连接
+const throttleRecoverSuccesses = 4
+
+// hostThrottle 单个主机的限流状态
+type hostThrottle struct {
+    limit        int       // 允许的并发连接数，0 表示不限制
+    active       int       // 当前连接数
+    blockedUntil time.Time // 在此之前不向该主机发起新请求
+    successes    int       // 上次调整并发数之后成功完成的块数
+}
+
+// isThrottleStatus 判断状态码是否表示服务器限流
+func isThrottleStatus(statusCode int) bool {
+    return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// parseRetryAfter 解析 Retry-After 响应头，支持秒数和HTTP日期两种格式
+func parseRetryAfter(value string) time.Duration {
+    value = strings.TrimSpace(value)
+    if value == "" {
+        return 0
+    }
+
+    if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+        if seconds < 0 {
+            return 0
+        }
+        return time.Duration(seconds) * time.Second
+    }
+
+    if date, err := http.ParseTime(value); err == nil {
+        if delay := time.Until(date); delay > 0 {
+            return delay
+        }
+    }
+    return 0
+}
+
+// hostOf 获取URL的主机名（含端口）
+func hostOf(rawURL string) string {
+    parsed, err := url.Parse(rawURL)
+    if err != nil {
+        return rawURL
+    }
+    return parsed.Host
+}
+
+// hostState 获取主机的限流状态，调用方需持有 fd.mutex
+func (fd *FastDownloader) hostState(host string) *hostThrottle {
+    if fd.hosts == nil {
+        fd.hosts = make(map[string]*hostThrottle)
+    }
+    state, ok := fd.hosts[host]
+    if !ok {
+        state = &hostThrottle{}
+        fd.hosts[host] = state
+    }
+    return state
+}
+
+// acquireHost 等待主机有空闲的连接名额并占用一个
+func (fd *FastDownloader) acquireHost(ctx context.Context, host string) error {
+    for {
+        fd.mutex.Lock()
+        state := fd.hostState(host)
+        wait := time.Until(state.blockedUntil)
+        if wait <= 0 && (state.limit == 0 || state.active < state.limit) {
+            state.active++
+            fd.mutex.Unlock()
+            return nil
+        }
+        fd.mutex.Unlock()
+
+        if wait <= 0 || wait > 100*time.Millisecond {
+            wait = 100 * time.Millisecond
+        }
+        select {
+        case <-ctx.Done():
+            return ctx.Err()
+        case <-time.After(wait):
+        }
+    }
+}
+
+// releaseHost 释放主机的连接名额
+func (fd *FastDownloader) releaseHost(host string) {
+    fd.mutex.Lock()
+    defer fd.mutex.Unlock()
+
+    state := fd.hostState(host)
+    if state.active > 0 {
+        state.active--
+    }
+}
+
+// acquireConnection 等待本下载器的连接预算以及下载管理器的总连接数、主机连接数都有空闲名额
+func (fd *FastDownloader) acquireConnection(ctx context.Context, host string) error {
+    if fd.connections != nil {
+        select {
+        case fd.connections <- struct{}{}:
+        case <-ctx.Done():
+            return ctx.Err()
+        }
+    }
+
+    if fd.manager != nil {
+        if err := fd.manager.acquire(ctx, host); err != nil {
+            if fd.connections != nil {
+                <-fd.connections
+            }
+            return err
+        }
+    }
+    return nil
+}
+
+// releaseConnection 归还 acquireConnection 占用的名额
+func (fd *FastDownloader) releaseConnection(host string) {
+    if fd.manager != nil {
+        fd.manager.release(host)
+    }
+    if fd.connections != nil {
+        <-fd.connections
+    }
+}
+
+// throttleHost 主机返回限流响应时减半其并发连接数，配置了 ThrottleAllChunks 时
+// 该主机的所有块都暂停到限流结束，返回调整后的并发数
+func (fd *FastDownloader) throttleHost(host string, delay time.Duration) int {
+    fd.mutex.Lock()
+    defer fd.mutex.Unlock()
+
+    state := fd.hostState(host)
+    limit := state.limit
+    if limit == 0 {
+        // 首次限流时以当前连接数（含被限流的这一个）为基准
+        limit = state.active + 1
+    }
+    limit /= 2
+    if limit < 1 {
+        limit = 1
+    }
+    state.limit = limit
+    state.successes = 0
+
+    if fd.config.ThrottleAllChunks {
+        if until := time.Now().Add(delay); until.After(state.blockedUntil) {
+            state.blockedUntil = until
+        }
+    }
+    return limit
+}
+
+// hostSucceeded 记录主机成功完成一个块，逐步恢复被限流时降低的并发数
+func (fd *FastDownloader) hostSucceeded(host string) {
+    fd.mutex.Lock()
+    defer fd.mutex.Unlock()
+
+    state := fd.hostState(host)
+    if state.limit == 0 {
+        return
+    }
+    state.successes++
+    if state.successes >= throttleRecoverSuccesses {
+        state.successes = 0
+        state.limit++
+        if state.limit >= fd.config.ThreadCount {
+            state.limit = 0
+        }
+    }
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "crypto/tls"
+    "crypto/x509"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/pem"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+)
+
+// TLSOptions HTTPS 连接的证书校验设置，零值表示使用系统根证书校验服务器证书、最低 TLS 1.2
+type TLSOptions struct {
+    CAFile             string   // CA 证书文件（PEM），设置后代替系统根证书
+    CAPEM              string   // CA 证书内容（PEM），可与 CAFile 同时使用
+    PinnedCertificates []string // 固定的证书：DER 编码的 SHA-256 指纹（十六进制，可带冒号）
+    PinnedPublicKeys   []string // 固定的公钥：SubjectPublicKeyInfo 的 SHA-256（base64，可带 "sha256//" 前缀）
+    MinVersion         string   // 最低 TLS 版本：1.0、1.1、1.2 或 1.3，为空时为 1.2
+    InsecureSkipVerify bool     // 不校验服务器证书（不安全），设置了固定证书或公钥时仍然检查服务器证书
+    ClientCertFile     string   // 客户端证书文件（PEM），服务器要求客户端证书时使用
+    ClientKeyFile      string   // 客户端私钥文件（PEM），为空时从证书文件中读取
+    ClientCertPEM      string   // 客户端证书内容（PEM），代替 ClientCertFile
+    ClientKeyPEM       string   // 客户端私钥内容（PEM），代替 ClientKeyFile
+    KeyPassword        string   // 加密私钥的密码
+}
+
+// errPinMismatch 服务器证书链中没有与固定的证书或公钥匹配的证书
+var errPinMismatch = errors.New("服务器证书与固定的证书或公钥不匹配")
+
+// tlsVersions 支持的最低 TLS 版本
+var tlsVersions = map[string]uint16{
+    "1.0": tls.VersionTLS10,
+    "1.1": tls.VersionTLS11,
+    "1.2": tls.VersionTLS12,
+    "1.3": tls.VersionTLS13,
+}
+
+// pinned 是否设置了固定证书或公钥
+func (options TLSOptions) pinned() bool {
+    return len(options.PinnedCertificates) > 0 || len(options.PinnedPublicKeys) > 0
+}
+
+// parseCertificatePin 解析证书指纹，返回 32 字节的 SHA-256
+func parseCertificatePin(pin string) ([]byte, error) {
+    cleaned := strings.NewReplacer(":", "", " ", "").Replace(strings.TrimSpace(pin))
+    decoded, err := hex.DecodeString(cleaned)
+    if err != nil || len(decoded) != sha256.Size {
+        return nil, fmt.Errorf("无效的证书指纹: %q", pin)
+    }
+    return decoded, nil
+}
+
+// parsePublicKeyPin 解析公钥指纹，返回 32 字节的 SHA-256
+func parsePublicKeyPin(pin string) ([]byte, error) {
+    cleaned := strings.TrimPrefix(strings.TrimSpace(pin), "sha256//")
+    decoded, err := base64.StdEncoding.DecodeString(cleaned)
+    if err != nil || len(decoded) != sha256.Size {
+        return nil, fmt.Errorf("无效的公钥指纹: %q", pin)
+    }
+    return decoded, nil
+}
+
+// readPEM 读取 PEM 内容，优先使用直接提供的内容，其次读取文件，都为空时返回 nil
+func readPEM(content string, path string, name string) ([]byte, error) {
+    if content != "" {
+        return []byte(content), nil
+    }
+    if path == "" {
+        return nil, nil
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        return nil, fmt.Errorf("读取%s失败: %v", name, err)
+    }
+    return data, nil
+}
+
+// decryptKey 解密 PEM 中加密的私钥，支持 PKCS#8 加密私钥（"ENCRYPTED PRIVATE KEY"）和
+// 传统的 PEM 加密（"Proc-Type: 4,ENCRYPTED"，RFC 1423，安全性较差，仅为兼容旧文件），未加密的私钥原样返回
+func decryptKey(keyPEM []byte, password string) ([]byte, error) {
+    var decrypted []byte
+    rest := keyPEM
+    for {
+        block, remaining := pem.Decode(rest)
+        if block == nil {
+            break
+        }
+        rest = remaining
+
+        encrypted := block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)
+        if encrypted && password == "" {
+            return nil, fmt.Errorf("客户端私钥已加密，需要提供密码")
+        }
+        switch {
+        case block.Type == "ENCRYPTED PRIVATE KEY":
+            der, err := decryptPKCS8(block.Bytes, password)
+            if err != nil {
+                return nil, fmt.Errorf("解密客户端私钥失败: %v", err)
+            }
+            block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+        case x509.IsEncryptedPEMBlock(block):
+            der, err := x509.DecryptPEMBlock(block, []byte(password))
+            if err != nil {
+                return nil, fmt.Errorf("解密客户端私钥失败: %v", err)
+            }
+            block = &pem.Block{Type: block.Type, Bytes: der}
+        }
+        decrypted = append(decrypted, pem.EncodeToMemory(block)...)
+    }
+    return decrypted, nil
+}
+
+// clientCertificate 加载客户端证书和私钥，没有设置客户端证书时返回 nil
+func clientCertificate(options TLSOptions) (*tls.Certificate, error) {
+    certPEM, err := readPEM(options.ClientCertPEM, options.ClientCertFile, "客户端证书")
+    if err != nil {
+        return nil, err
+    }
+    keyPEM, err := readPEM(options.ClientKeyPEM, options.ClientKeyFile, "客户端私钥")
+    if err != nil {
+        return nil, err
+    }
+    if certPEM == nil {
+        if keyPEM != nil {
+            return nil, fmt.Errorf("设置了客户端私钥但没有客户端证书")
+        }
+        return nil, nil
+    }
+    // 证书和私钥可以放在同一个文件中
+    if keyPEM == nil {
+        keyPEM = certPEM
+    }
+
+    keyPEM, err = decryptKey(keyPEM, options.KeyPassword)
+    if err != nil {
+        return nil, err
+    }
+    certificate, err := tls.X509KeyPair(certPEM, keyPEM)
+    if err != nil {
+        return nil, fmt.Errorf("加载客户端证书失败: %v", err)
+    }
+    return &certificate, nil
+}
+
+// tlsConfig 根据设置创建 TLS 配置，CA 证书或客户端证书无法读取、指纹格式错误时返回错误
+func tlsConfig(options TLSOptions) (*tls.Config, error) {
+    config := &tls.Config{
+        MinVersion:         tls.VersionTLS12,
+        InsecureSkipVerify: options.InsecureSkipVerify,
+    }
+
+    if options.MinVersion != "" {
+        version, ok := tlsVersions[options.MinVersion]
+        if !ok {
+            return nil, fmt.Errorf("不支持的 TLS 版本: %s", options.MinVersion)
+        }
+        config.MinVersion = version
+    }
+
+    if options.CAFile != "" || options.CAPEM != "" {
+        pool := x509.NewCertPool()
+        if options.CAFile != "" {
+            data, err := os.ReadFile(options.CAFile)
+            if err != nil {
+                return nil, fmt.Errorf("读取 CA 证书失败: %v", err)
+            }
+            if !pool.AppendCertsFromPEM(data) {
+                return nil, fmt.Errorf("CA 证书文件中没有有效的证书: %s", options.CAFile)
+            }
+        }
+        if options.CAPEM != "" && !pool.AppendCertsFromPEM([]byte(options.CAPEM)) {
+            return nil, fmt.Errorf("CA 证书内容中没有有效的证书")
+        }
+        config.RootCAs = pool
+    }
+
+    certificate, err := clientCertificate(options)
+    if err != nil {
+        return nil, err
+    }
+    if certificate != nil {
+        config.Certificates = []tls.Certificate{*certificate}
+    }
+
+    var certPins, keyPins [][]byte
+    for _, pin := range options.PinnedCertificates {
+        decoded, err := parseCertificatePin(pin)
+        if err != nil {
+            return nil, err
+        }
+        certPins = append(certPins, decoded)
+    }
+    for _, pin := range options.PinnedPublicKeys {
+        decoded, err := parsePublicKeyPin(pin)
+        if err != nil {
+            return nil, err
+        }
+        keyPins = append(keyPins, decoded)
+    }
+    if options.pinned() {
+        // 服务器发送的证书链中除第一个证书以外的证书可以随意添加，只能信任校验通过的证书链：
+        // 校验证书时校验通过的证书链中任意一个证书匹配即可；不校验证书时只检查服务器证书，
+        // 它的私钥在握手中得到了证明
+        config.VerifyConnection = func(state tls.ConnectionState) error {
+            var certificates []*x509.Certificate
+            if options.InsecureSkipVerify {
+                if len(state.PeerCertificates) > 0 {
+                    certificates = state.PeerCertificates[:1]
+                }
+            } else {
+                for _, chain := range state.VerifiedChains {
+                    certificates = append(certificates, chain...)
+                }
+            }
+            for _, certificate := range certificates {
+                certSum := sha256.Sum256(certificate.Raw)
+                keySum := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+                for _, pin := range certPins {
+                    if bytes.Equal(pin, certSum[:]) {
+                        return nil
+                    }
+                }
+                for _, pin := range keyPins {
+                    if bytes.Equal(pin, keySum[:]) {
+                        return nil
+                    }
+                }
+            }
+            return errPinMismatch
+        }
+    }
+    return config, nil
+}
+
+// isCertificateError 判断是否为服务器证书校验失败，这类错误重试没有意义
+func isCertificateError(err error) bool {
+    var verifyErr *tls.CertificateVerificationError
+    return errors.As(err, &verifyErr) || errors.Is(err, errPinMismatch)
+}
+
+// SetTLSOptions 设置证书校验，设置无效时返回错误，在下一次开始下载时生效
+func (fd *FastDownloader) SetTLSOptions(options TLSOptions) error {
+    if _, err := tlsConfig(options); err != nil {
+        return err
+    }
+
+    fd.mutex.Lock()
+    defer fd.mutex.Unlock()
+
+    fd.config.TLS = options
+    return nil
+}